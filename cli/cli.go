@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"github.com/andrebq/appshell/shell"
+)
+
+type (
+	Shell interface {
+		Parse(ctx context.Context, code string) (string, error)
+		Eval(ctx context.Context, stdout, stderr io.Writer, code string, in io.Reader) error
+		SetOutput(stdout, stderr io.Writer)
+		Close() error
+	}
+
+	// permissionPrompter is implemented by shells which can ask
+	// about resources their policy does not grant
+	permissionPrompter interface {
+		SetPermissionPrompt(shell.PermissionPrompt)
+	}
+)
+
+// Run starts an interactive session, reading commands from in.
+//
+// Commands which do not parse yet are assumed to continue on the next
+// line, an empty line can be used to discard them. Resources the policy
+// does not grant are asked for, while a command is running.
+func Run(ctx context.Context, sh Shell, in io.Reader, stdout, stderr io.Writer) error {
+	sh.SetOutput(stdout, stderr)
+	defer sh.Close()
+
+	// scripts read from the same buffer, so input typed
+	// for them is not taken as commands
+	rd := bufio.NewReader(in)
+	// callbacks from timers, events or servers run between commands,
+	// while the next one is being read, so they cannot ask
+	var evaluating atomic.Bool
+	if p, ok := sh.(permissionPrompter); ok {
+		p.SetPermissionPrompt(func(ctx context.Context, req shell.PermissionRequest) shell.Decision {
+			if !evaluating.Load() {
+				return shell.Deny
+			}
+			return askPermission(rd, stdout, req)
+		})
+	}
+	var code strings.Builder
+	for ctx.Err() == nil {
+		if code.Len() == 0 {
+			fmt.Fprint(stdout, ">>> ")
+		} else {
+			fmt.Fprint(stdout, "... ")
+		}
+		line, err := rd.ReadString('\n')
+		if err == io.EOF && line == "" {
+			fmt.Fprintln(stdout)
+			return nil
+		} else if err != nil && err != io.EOF {
+			return err
+		}
+		code.WriteString(line)
+
+		cmd, err := sh.Parse(ctx, code.String())
+		if err != nil && strings.TrimSpace(line) != "" {
+			continue
+		}
+		code.Reset()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			continue
+		}
+		if len(cmd) == 0 {
+			continue
+		}
+		evaluating.Store(true)
+		err = sh.Eval(ctx, stdout, stderr, cmd, rd)
+		evaluating.Store(false)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+		}
+	}
+	return ctx.Err()
+}
+
+// askPermission reads the answer from the next line, anything but
+// once or session denies the request
+func askPermission(rd *bufio.Reader, out io.Writer, req shell.PermissionRequest) shell.Decision {
+	fmt.Fprintf(out, "allow %v %q? [o]nce, [s]ession, [N]o: ", req.Capability, req.Resource)
+	line, _ := rd.ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "o", "once":
+		return shell.AllowOnce
+	case "s", "session":
+		return shell.AllowSession
+	}
+	return shell.Deny
+}
+
+// Batch evaluates code and returns once it finishes
+func Batch(ctx context.Context, sh Shell, code string, in io.Reader, stdout, stderr io.Writer) error {
+	sh.SetOutput(stdout, stderr)
+	defer sh.Close()
+
+	cmd, err := sh.Parse(ctx, code)
+	if err != nil {
+		return err
+	}
+	return sh.Eval(ctx, stdout, stderr, cmd, in)
+}
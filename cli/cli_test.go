@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/andrebq/appshell/shell"
+)
+
+func TestRunPermissionPrompt(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		deny  bool
+	}{
+		{"once", "math := import(\"math\")\no\nmath.pi > 3\n", "true", false},
+		{"session", "math := import(\"math\")\ns\nmath2 := import(\"math\")\nmath2.pi > 3\n", "true", false},
+		{"deny", "math := import(\"math\")\nn\n", "", true},
+		{"end of input", "math := import(\"math\")\n", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh := shell.New()
+			sh.SetPolicy(&shell.Policy{})
+			var stdout, stderr strings.Builder
+			if err := Run(context.Background(), sh, strings.NewReader(tt.input), &stdout, &stderr); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(stdout.String(), `allow module "math"?`) {
+				t.Fatalf("permission was not asked: %v", stdout.String())
+			}
+			denied := strings.Contains(stderr.String(), "not allowed")
+			if denied != tt.deny {
+				t.Fatalf("expected denied to be %v: %v", tt.deny, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tt.want) {
+				t.Fatalf("expected %v in %v", tt.want, stdout.String())
+			}
+		})
+	}
+}
+
+func TestBatchDoesNotPrompt(t *testing.T) {
+	sh := shell.New()
+	sh.SetPolicy(&shell.Policy{})
+	var stdout, stderr strings.Builder
+	err := Batch(context.Background(), sh, `math := import("math")`, strings.NewReader("s\n"), &stdout, &stderr)
+	if err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("expected the import to be denied, got %v", err)
+	}
+}
@@ -2,51 +2,156 @@ package gui
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"math"
 	"os"
-	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/data/binding"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
 	"fyne.io/fyne/v2/widget"
+	"github.com/andrebq/appshell/shell"
+	"github.com/andrebq/appshell/workspace"
 )
 
 type (
 	win struct {
 		widget  fyne.Window
-		output  binding.String
+		output  *outputView
 		nextCmd binding.String
 
-		history history
+		history     history
+		historyLog  *historyLog
+		permissions permissions
+
+		snapshots *snapshotStore
+		// suggested when saving the next snapshot
+		lastSnapshot string
+
+		// recorded with each history entry
+		sessionID string
+		ws        *workspace.Workspace
 
 		ctx context.Context
 		sh  Shell
+
+		// used to open other workspaces in new windows
+		app    fyne.App
+		appCtx context.Context
+		open   Opener
+
+		mu         sync.Mutex
+		cancelEval context.CancelFunc
+	}
+
+	// outputWriter appends everything written to it to the output view
+	// as soon as it arrives
+	outputWriter struct {
+		w     *win
+		style outputStyle
+	}
+
+	redacter interface {
+		Redact(text string) string
+	}
+
+	// promptReader answers input requests from scripts
+	// by asking the user with a dialog
+	promptReader struct {
+		w   *win
+		ctx context.Context
 	}
 
 	Shell interface {
 		Snapshot(ctx context.Context, out io.Writer) error
+		ExportSnapshot(ctx context.Context, out io.Writer, format string) error
 		RestoreSnapshot(ctx context.Context, in io.Reader) error
 		Parse(ctx context.Context, code string) (string, error)
 		Eval(ctx context.Context, stdout, stderr io.Writer, code string, in io.Reader) error
+		SetOutput(stdout, stderr io.Writer)
+		Reset(ctx context.Context) error
+		Close() error
 	}
 
-	emptyBuffer struct{}
+	// Opener creates the shell for a workspace, ctx is
+	// cancelled once the window using it is closed
+	Opener func(ctx context.Context, ws *workspace.Workspace) (Shell, error)
+)
+
+const (
+	appID = "io.github.andrebq.appshell"
+
+	prefLiveHistory     = "history.live"
+	historySyncInterval = 2 * time.Second
+)
+
+var (
+	errEvalRunning = errors.New("another command is still running")
 )
 
-func (emptyBuffer) Read(out []byte) (int, error) {
+func (promptReader) Read(out []byte) (int, error) {
 	return 0, io.EOF
 }
 
-func (w *win) evalCmd(updateHistory bool) {
-	combined := strings.Builder{}
+// Prompt is called from the goroutine running the script,
+// which stays paused until the user answers
+func (p promptReader) Prompt(prompt string) (string, error) {
+	type answer struct {
+		text string
+		ok   bool
+	}
+	reply := make(chan answer, 1)
+	entry := widget.NewEntry()
+	label := prompt
+	if label == "" {
+		label = "Input"
+	}
+	d := dialog.NewForm("Input requested", "OK", "Cancel",
+		[]*widget.FormItem{widget.NewFormItem(label, entry)},
+		func(ok bool) { reply <- answer{text: entry.Text, ok: ok} },
+		p.w.widget)
+	d.Show()
+	p.w.widget.Canvas().Focus(entry)
+
+	select {
+	case a := <-reply:
+		if !a.ok {
+			return "", io.EOF
+		}
+		p.w.appendOutput(styleStdout, fmt.Sprintf("%v%v\n", prompt, a.text))
+		return a.text, nil
+	case <-p.ctx.Done():
+		d.Hide()
+		return "", p.ctx.Err()
+	}
+}
+
+func (o outputWriter) Write(buf []byte) (int, error) {
+	o.w.appendOutput(o.style, string(buf))
+	return len(buf), nil
+}
+
+// WriteStyled renders text using the style requested by the script,
+// unknown styles fallback to the style of the writer
+func (o outputWriter) WriteStyled(style shell.Style, text string) (int, error) {
+	st, found := shellStyles[style]
+	if !found {
+		st = o.style
+	}
+	o.w.appendOutput(st, text)
+	return len(text), nil
+}
 
+func (w *win) evalCmd(updateHistory bool) {
 	cmd, _ := w.nextCmd.Get()
 
 	cmd, err := w.sh.Parse(w.ctx, cmd)
@@ -57,25 +162,78 @@ func (w *win) evalCmd(updateHistory bool) {
 	if len(cmd) == 0 {
 		return
 	}
-	combined.WriteString(cmd)
-	combined.WriteString("\n---\n")
+	ctx, ok := w.startEval()
+	if !ok {
+		w.showError(errEvalRunning)
+		return
+	}
 
-	err = w.sh.Eval(w.ctx, &combined, &combined, cmd, emptyBuffer{})
-	if err != nil {
-		fmt.Fprintf(&combined, "%v", err)
-	} else {
+	if !w.output.empty() {
+		w.appendOutput(styleStdout, "\n")
+	}
+	w.appendOutput(styleCommand, fmt.Sprintf("%v\n---\n", cmd))
+
+	// eval runs outside the UI thread, so output produced by
+	// long running commands shows up while they are still running
+	go func() {
+		defer w.stopEval()
+		stdout := outputWriter{w: w, style: styleStdout}
+		stderr := outputWriter{w: w, style: styleStderr}
+		start := time.Now()
+		err := w.sh.Eval(ctx, stdout, stderr, cmd, promptReader{w: w, ctx: ctx})
 		if updateHistory {
-			w.history.add(cmd)
+			w.recordHistory(historyEntry{
+				Code:      cmd,
+				Time:      start,
+				Duration:  time.Since(start),
+				Workspace: w.ws.Root,
+				Session:   w.sessionID,
+				Error:     errorText(err),
+			})
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%v\n", err)
+			return
 		}
 		w.nextCmd.Set("")
+	}()
+}
+
+func (w *win) startEval() (context.Context, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancelEval != nil {
+		return nil, false
 	}
+	ctx, cancel := context.WithCancel(w.ctx)
+	w.cancelEval = cancel
+	return ctx, true
+}
 
-	previous, _ := w.output.Get()
-	if previous == "" {
-		w.output.Set(combined.String())
-	} else {
-		w.output.Set(fmt.Sprintf("%v\n%v", previous, combined.String()))
+func (w *win) stopEval() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancelEval == nil {
+		return
 	}
+	w.cancelEval()
+	w.cancelEval = nil
+}
+
+func (w *win) appendOutput(style outputStyle, text string) {
+	w.output.append(style, text)
+}
+
+func (w *win) reset() {
+	w.stopEval()
+	go func() {
+		err := w.sh.Reset(w.ctx)
+		if err != nil {
+			w.showError(err)
+			return
+		}
+		w.appendOutput(styleCommand, "\n--- session reset ---\n")
+	}()
 }
 
 func (w *win) showError(err error) {
@@ -85,60 +243,89 @@ func (w *win) showError(err error) {
 	dialog.NewError(err, w.widget).Show()
 }
 
-func (w *win) snapshot() {
-	fd, err := os.OpenFile("./snapshot.json", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
-	if err != nil {
-		w.showError(err)
-	}
-	defer fd.Close()
-	err = w.sh.Snapshot(w.ctx, fd)
-	if err != nil {
-		w.showError(err)
-	}
-	err = fd.Sync()
-	if err != nil {
-		dialog.NewError(err, w.widget).Show()
+// exportSnapshot saves the variables in the format
+// matching the extension chosen by the user
+func (w *win) exportSnapshot() {
+	d := dialog.NewFileSave(func(fd fyne.URIWriteCloser, err error) {
+		if err != nil || fd == nil {
+			w.showError(err)
+			return
+		}
+		format := strings.TrimPrefix(fd.URI().Extension(), ".")
+		if format == "yml" {
+			format = "yaml"
+		}
+		// the session might be busy running a command
+		go func() {
+			defer fd.Close()
+			w.showError(w.sh.ExportSnapshot(w.ctx, fd, format))
+		}()
+	}, w.widget)
+	d.SetFileName("snapshot.yaml")
+	d.SetFilter(storage.NewExtensionFileFilter([]string{".json", ".yaml", ".yml", ".toml", ".csv"}))
+	d.Show()
+}
+
+// recordHistory adds the entry to the history and appends it,
+// redacted, to the log shared with other instances
+func (w *win) recordHistory(e historyEntry) {
+	w.history.add(e)
+	if r, ok := w.sh.(redacter); ok {
+		e.Code = r.Redact(e.Code)
+		e.Error = r.Redact(e.Error)
 	}
+	w.showError(w.historyLog.append(w.ctx, e))
 }
 
+// saveHistory compacts the log if it grew too large,
+// entries were already saved as they were recorded
 func (w *win) saveHistory() {
-	w.history.dedup()
-	buf, err := json.Marshal(w.history)
-	if err != nil {
-		w.showError(err)
+	if !w.historyLog.needsCompaction() {
+		return
 	}
-	err = os.WriteFile("./history.json", buf, 0600)
-	if err != nil {
-		w.showError(err)
+	if err := w.historyLog.compact(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
 	}
 }
 
 func (w *win) loadHistory() {
-	buf, err := os.ReadFile("./history.json")
-	if os.IsNotExist(err) {
-		return
-	}
-	if err != nil {
+	if err := w.historyLog.migrate(w.ctx, w.ws.LegacyHistoryFile()); err != nil {
 		w.showError(err)
 		return
 	}
-	err = json.Unmarshal(buf, &w.history)
+	w.syncHistory()
+	if w.historyLog.needsCompaction() {
+		w.showError(w.historyLog.compact(w.ctx))
+		w.syncHistory()
+	}
+}
+
+// syncHistory merges the entries added to the log by other instances
+func (w *win) syncHistory() {
+	entries, reset, err := w.historyLog.read(w.ctx)
 	if err != nil {
 		w.showError(err)
 		return
 	}
-	w.history.idx = len(w.history.Entries)
+	if reset || len(entries) > 0 {
+		w.history.merge(entries, reset, w.sessionID)
+	}
 }
 
-func (w *win) reloadSnapshot() {
-	fd, err := os.Open("./snapshot.json")
-	if err != nil {
-		dialog.NewError(err, w.widget).Show()
-	}
-	defer fd.Close()
-	err = w.sh.RestoreSnapshot(w.ctx, fd)
-	if err != nil {
-		dialog.NewError(err, w.widget).Show()
+// shareHistory keeps merging entries from other instances
+// while live sharing is enabled in the preferences
+func (w *win) shareHistory(prefs fyne.Preferences) {
+	t := time.NewTicker(historySyncInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-t.C:
+		}
+		if prefs.BoolWithFallback(prefLiveHistory, false) {
+			w.syncHistory()
+		}
 	}
 }
 
@@ -150,38 +337,99 @@ func (w *win) updateHistory(back bool) {
 	}
 }
 
-func Run(ctx context.Context, sh Shell) error {
-	a := app.New()
-	w := a.NewWindow("Appshell")
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// newSessionID identifies the history entries of this window
+func newSessionID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Run shows a window for ws, other workspaces can be opened
+// from it and the application exits once all windows are closed
+func Run(ctx context.Context, ws *workspace.Workspace, open Opener) error {
+	a := app.NewWithID(appID)
+	rememberWorkspace(a.Preferences(), ws.Root)
+	if err := openWindow(ctx, a, ws, open); err != nil {
+		return err
+	}
+	a.Run()
+	return ctx.Err()
+}
+
+func openWindow(appCtx context.Context, a fyne.App, ws *workspace.Workspace, open Opener) error {
+	ctx, cancel := context.WithCancel(appCtx)
+	sh, err := open(ctx, ws)
+	if err != nil {
+		cancel()
+		return err
+	}
+	w := a.NewWindow(fmt.Sprintf("Appshell - %v", ws.Name()))
 	w.Resize(fyne.Size{Width: 960, Height: 600})
 
 	win := &win{
 		widget:  w,
-		output:  binding.NewString(),
+		output:  newOutputView(),
 		nextCmd: binding.NewString(),
 
 		sh:  sh,
 		ctx: ctx,
-	}
 
-	outputView := widget.NewEntryWithData(win.output)
-	outputView.MultiLine = true
-	scroller := binding.NewDataListener(func() {
-		outputView.CursorRow = math.MaxInt
-		outputView.Refresh()
-	})
-	runtime.SetFinalizer(outputView, func(_ any) { win.output.RemoveListener(scroller) })
-	win.output.AddListener(scroller)
+		app:    a,
+		appCtx: appCtx,
+		open:   open,
 
+		sessionID:  newSessionID(),
+		ws:         ws,
+		historyLog: newHistoryLog(ws.HistoryFile()),
+		snapshots:  newSnapshotStore(ws),
+	}
 	nextCmdView := newCodeEntryWithData(win.nextCmd)
 	nextCmdView.MultiLine = true
 	nextCmdView.SetMinRowsVisible(5)
 
 	runBtn := widget.NewButton("Run", func() { win.evalCmd(true) })
+	stopBtn := widget.NewButton("Stop", win.stopEval)
 	snapshotBtn := widget.NewButton("Snapshot", win.snapshot)
-	reloadBtn := widget.NewButton("Reload", win.reloadSnapshot)
-	hbox := container.New(hfill{}, nextCmdView, container.NewPadded(container.NewVBox(runBtn, snapshotBtn, reloadBtn)))
-	vs := container.NewVSplit(outputView, hbox)
+	browseBtn := widget.NewButton("Snapshots", win.browseSnapshots)
+	exportBtn := widget.NewButton("Export", win.exportSnapshot)
+	resetBtn := widget.NewButton("Reset", win.reset)
+	buttons := container.NewVBox(runBtn, stopBtn, snapshotBtn, browseBtn, exportBtn, resetBtn)
+	if sm, ok := sh.(secretsManager); ok {
+		buttons.Add(widget.NewButton("Secrets", func() { win.manageSecrets(sm) }))
+	}
+	hbox := container.New(hfill{}, nextCmdView, container.NewPadded(buttons))
+	logs := newLogPane()
+	if lh, ok := sh.(logHandlerSetter); ok {
+		lh.SetLogHandler(&logHandler{pane: logs, next: lh.LogHandler()})
+	}
+	historyTab := newHistorySearch(&win.history, func(code string) { win.nextCmd.Set(code) })
+	liveHistory := widget.NewCheck("Share live with other windows", func(on bool) {
+		a.Preferences().SetBool(prefLiveHistory, on)
+	})
+	liveHistory.SetChecked(a.Preferences().BoolWithFallback(prefLiveHistory, false))
+	outputBar := container.NewHBox(widget.NewButton("Copy", func() { win.output.copy(w.Clipboard()) }))
+	tabs := container.NewAppTabs(
+		container.NewTabItem("Output", container.NewBorder(outputBar, nil, nil, nil, win.output.scroll)),
+		container.NewTabItem("Log", logs.content()),
+		container.NewTabItem("History", container.NewBorder(nil, liveHistory, nil, nil, historyTab.content())),
+	)
+	tabs.OnSelected = func(item *container.TabItem) {
+		if item.Text == "History" {
+			historyTab.refresh()
+		}
+	}
+	if jv, ok := sh.(jobsViewer); ok {
+		jobs := newJobsPane(ctx, jv, win.showError)
+		tabs.Append(container.NewTabItem("Jobs", jobs.content()))
+	}
+	vs := container.NewVSplit(tabs, hbox)
 	vs.SetOffset(1.0)
 
 	evalcmd := func(_ fyne.Shortcut) {
@@ -198,14 +446,21 @@ func Run(ctx context.Context, sh Shell) error {
 	nextCmdView.RegisterShortcut(fyne.KeyUp, fyne.KeyModifierSuper, updateHistory(true))
 	nextCmdView.RegisterShortcut(fyne.KeyDown, fyne.KeyModifierControl, updateHistory(false))
 	nextCmdView.RegisterShortcut(fyne.KeyDown, fyne.KeyModifierSuper, updateHistory(false))
+	searchHistory := func(_ fyne.Shortcut) { win.searchHistory() }
+	nextCmdView.RegisterShortcut(fyne.KeyR, fyne.KeyModifierControl, searchHistory)
+	nextCmdView.RegisterShortcut(fyne.KeyR, fyne.KeyModifierSuper, searchHistory)
+
+	// output from handlers and other background events
+	sh.SetOutput(outputWriter{w: win, style: styleStdout}, outputWriter{w: win, style: styleStderr})
 
 	w.SetOnClosed(func() {
 		win.saveHistory()
+		sh.Close()
+		cancel()
 	})
 
+	w.SetMainMenu(win.mainMenu())
 	w.SetContent(vs)
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
 	go func() {
 		<-ctx.Done()
 		w.Close()
@@ -213,7 +468,11 @@ func Run(ctx context.Context, sh Shell) error {
 	w.Show()
 
 	win.loadHistory()
-
-	w.ShowAndRun()
-	return ctx.Err()
+	win.showError(win.snapshots.importLegacy(ws.LegacySnapshotFile()))
+	go win.shareHistory(a.Preferences())
+	win.loadPermissions()
+	if p, ok := sh.(permissionPrompter); ok {
+		p.SetPermissionPrompt(win.askPermission)
+	}
+	return nil
 }
@@ -1,43 +1,123 @@
 package gui
 
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
 type (
 	history struct {
-		Entries []string `json:"entries"`
+		mu      sync.Mutex
+		Entries []historyEntry `json:"entries"`
 		idx     int
 	}
+
+	historyEntry struct {
+		Code      string        `json:"code"`
+		Time      time.Time     `json:"time"`
+		Duration  time.Duration `json:"duration"`
+		Error     string        `json:"error,omitempty"`
+		Workspace string        `json:"workspace,omitempty"`
+		Session   string        `json:"session,omitempty"`
+	}
+
+	historyMatch struct {
+		historyEntry
+		score int
+	}
 )
 
-func (h *history) dedup() {
+// UnmarshalJSON accepts the entries saved by older versions,
+// which only kept the code
+func (e *historyEntry) UnmarshalJSON(buf []byte) error {
+	var code string
+	if err := json.Unmarshal(buf, &code); err == nil {
+		*e = historyEntry{Code: code}
+		return nil
+	}
+	type plain historyEntry
+	return json.Unmarshal(buf, (*plain)(e))
+}
+
+// dedupEntries keeps only the most recent occurrence of each command
+func dedupEntries(entries []historyEntry) []historyEntry {
 	set := map[string]int{}
-	for i, v := range h.Entries {
-		set[v] = i
+	for i, v := range entries {
+		set[v.Code] = i
 	}
-	var final []string
-	for i, v := range h.Entries {
-		last := set[v]
+	var final []historyEntry
+	for i, v := range entries {
+		last := set[v.Code]
 		if last == i {
 			final = append(final, v)
 		}
 	}
-	h.Entries = final
-	h.idx = len(h.Entries)
+	return final
 }
 
-func (h *history) add(code string) {
-	h.Entries = append(h.Entries, code)
+func (h *history) add(e historyEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.Entries = append(h.Entries, e)
+	h.trim()
 	h.idx = len(h.Entries)
 }
 
+// merge adds the entries read from the log, reset replaces all
+// entries. Entries from session were already added by add
+func (h *history) merge(entries []historyEntry, reset bool, session string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// keep the position of someone navigating the history
+	atEnd := h.idx >= len(h.Entries)
+	if reset {
+		h.Entries = append([]historyEntry(nil), entries...)
+	} else {
+		for _, e := range entries {
+			if e.Session != session || session == "" {
+				h.Entries = append(h.Entries, e)
+			}
+		}
+	}
+	h.trim()
+	if atEnd || reset {
+		h.idx = len(h.Entries)
+	}
+}
+
+// trim must be called with the lock held
+func (h *history) trim() {
+	if len(h.Entries) > maxHistoryEntries {
+		h.Entries = h.Entries[len(h.Entries)-maxHistoryEntries:]
+	}
+}
+
+// entries returns a copy of the entries, oldest first
+func (h *history) entries() []historyEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]historyEntry(nil), h.Entries...)
+}
+
 func (h *history) back() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	h.idx--
 	return h.peek()
 }
 
 func (h *history) forward() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	h.idx++
 	return h.peek()
 }
 
+// peek must be called with the lock held
 func (h *history) peek() string {
 	if len(h.Entries) == 0 {
 		return ""
@@ -48,5 +128,76 @@ func (h *history) peek() string {
 	if h.idx >= len(h.Entries) {
 		h.idx = len(h.Entries) - 1
 	}
-	return h.Entries[h.idx]
+	return h.Entries[h.idx].Code
+}
+
+// search returns the entries matching query, best matches first and
+// the most recent among equally good ones. An empty query matches
+// everything, most recent first
+func (h *history) search(query string) []historyMatch {
+	entries := h.entries()
+	var out []historyMatch
+	for i := len(entries) - 1; i >= 0; i-- {
+		score, ok := fuzzyScore(query, entries[i].Code)
+		if ok {
+			out = append(out, historyMatch{historyEntry: entries[i], score: score})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].score > out[j].score })
+	return out
+}
+
+// fuzzyScore checks if the characters of query appear in text in order,
+// ignoring case. Consecutive characters, matches at the start of words
+// and exact substrings rank higher
+func fuzzyScore(query, text string) (int, bool) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return 0, true
+	}
+	lower := strings.ToLower(text)
+	score := 0
+	if strings.Contains(lower, query) {
+		score += 100
+	}
+	q := []rune(query)
+	qi := 0
+	prevMatch := false
+	prev := ' '
+	for _, r := range lower {
+		if qi < len(q) && r == q[qi] {
+			score++
+			if prevMatch {
+				score += 5
+			}
+			if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+				score += 3
+			}
+			qi++
+			prevMatch = true
+		} else {
+			prevMatch = false
+		}
+		prev = r
+	}
+	if qi < len(q) {
+		return 0, false
+	}
+	return score, true
+}
+
+// summary is the text shown in the history lists
+func (e historyEntry) summary() string {
+	code := strings.TrimSpace(e.Code)
+	if i := strings.IndexByte(code, '\n'); i >= 0 {
+		code = code[:i] + " …"
+	}
+	status := "ok"
+	if e.Error != "" {
+		status = "failed"
+	}
+	if e.Time.IsZero() {
+		return code
+	}
+	return e.Time.Format(time.DateTime) + "  " + e.Duration.Round(time.Millisecond).String() + "  " + status + "  " + code
 }
@@ -0,0 +1,188 @@
+package gui
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistorySearch(t *testing.T) {
+	var h history
+	for _, code := range []string{
+		`fmt.println("a")`,
+		`jsonrpc.call(url, "add", [1, 2])`,
+		`json.encode(x)`,
+		`fmt.println("b")`,
+		`x := {call: 1}`,
+	} {
+		h.add(historyEntry{Code: code})
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// most recent first
+		{"", []string{`x := {call: 1}`, `fmt.println("b")`, `json.encode(x)`, `jsonrpc.call(url, "add", [1, 2])`, `fmt.println("a")`}},
+		{"  ", []string{`x := {call: 1}`, `fmt.println("b")`, `json.encode(x)`, `jsonrpc.call(url, "add", [1, 2])`, `fmt.println("a")`}},
+		{"PRINTLN", []string{`fmt.println("b")`, `fmt.println("a")`}},
+		// substrings rank above scattered matches
+		{"json", []string{`json.encode(x)`, `jsonrpc.call(url, "add", [1, 2])`}},
+		{"call", []string{`x := {call: 1}`, `jsonrpc.call(url, "add", [1, 2])`}},
+		{"jrc", []string{`jsonrpc.call(url, "add", [1, 2])`}},
+		{"fpb", []string{`fmt.println("b")`}},
+		{"zzz", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var got []string
+			for _, m := range h.search(tt.query) {
+				got = append(got, m.Code)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoryNavigation(t *testing.T) {
+	var h history
+	if got := h.back(); got != "" {
+		t.Errorf("empty history returned %q", got)
+	}
+	for _, code := range []string{"a", "b", "c"} {
+		h.add(historyEntry{Code: code})
+	}
+	var got []string
+	for _, back := range []bool{true, true, true, true, false, false, false} {
+		if back {
+			got = append(got, h.back())
+		} else {
+			got = append(got, h.forward())
+		}
+	}
+	if want := "c,b,a,a,b,c,c"; strings.Join(got, ",") != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestHistoryMerge(t *testing.T) {
+	var h history
+	h.add(historyEntry{Code: "mine", Session: "s1"})
+	h.merge([]historyEntry{{Code: "mine", Session: "s1"}, {Code: "theirs", Session: "s2"}}, false, "s1")
+	if got := codes(h.entries()); got != "mine,theirs" {
+		t.Errorf("got %v after merge", got)
+	}
+	h.merge([]historyEntry{{Code: "a"}, {Code: "b"}}, true, "s1")
+	if got := codes(h.entries()); got != "a,b" {
+		t.Errorf("got %v after reset", got)
+	}
+}
+
+func TestHistoryEntryLegacy(t *testing.T) {
+	var saved struct {
+		Entries []historyEntry `json:"entries"`
+	}
+	buf := `{"entries": ["old", {"code": "new", "duration": 1000000, "error": "boom"}]}`
+	if err := json.Unmarshal([]byte(buf), &saved); err != nil {
+		t.Fatal(err)
+	}
+	want := []historyEntry{{Code: "old"}, {Code: "new", Duration: time.Millisecond, Error: "boom"}}
+	if len(saved.Entries) != len(want) || saved.Entries[0] != want[0] || saved.Entries[1] != want[1] {
+		t.Errorf("got %+v, want %+v", saved.Entries, want)
+	}
+}
+
+func TestHistoryLog(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history.jsonl")
+	legacy := filepath.Join(dir, "history.json")
+	if err := os.WriteFile(legacy, []byte(`{"entries": ["a", "b"]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	first, second := newHistoryLog(path), newHistoryLog(path)
+	// only the first migration copies the old entries
+	for _, l := range []*historyLog{first, second} {
+		if err := l.migrate(ctx, legacy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, reset, err := first.read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := codes(entries); got != "a,b" || !reset {
+		t.Errorf("first read got %v, reset %v", got, reset)
+	}
+
+	if err := second.append(ctx, historyEntry{Code: "c", Session: "s2"}); err != nil {
+		t.Fatal(err)
+	}
+	entries, reset, err = first.read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := codes(entries); got != "c" || reset {
+		t.Errorf("second read got %v, reset %v", got, reset)
+	}
+
+	// a partial line is left for the next read
+	fd, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.WriteString(`{"code": "d"`)
+	fd.Close()
+	if entries, _, _ := first.read(ctx); len(entries) != 0 {
+		t.Errorf("partial line was read: %v", codes(entries))
+	}
+	fd, _ = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	fd.WriteString("}\n")
+	fd.Close()
+	if entries, _, _ := first.read(ctx); codes(entries) != "d" {
+		t.Errorf("completed line was not read: %v", codes(entries))
+	}
+}
+
+func TestHistoryLogCompact(t *testing.T) {
+	ctx := context.Background()
+	l := newHistoryLog(filepath.Join(t.TempDir(), "history.jsonl"))
+	var entries []historyEntry
+	for i := 0; i <= 2*maxHistoryEntries; i++ {
+		entries = append(entries, historyEntry{Code: "same"})
+	}
+	entries = append(entries, historyEntry{Code: "last"})
+	if err := l.write(entries...); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := l.read(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !l.needsCompaction() {
+		t.Fatal("the log should need compaction")
+	}
+	if err := l.compact(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// readers start over after the file is replaced
+	got, reset, err := l.read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codes(got) != "same,last" || !reset || l.needsCompaction() {
+		t.Errorf("got %v, reset %v after compaction", codes(got), reset)
+	}
+}
+
+func codes(entries []historyEntry) string {
+	out := make([]string, len(entries))
+	for i, e := range entries {
+		out[i] = e.Code
+	}
+	return strings.Join(out, ",")
+}
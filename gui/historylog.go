@@ -0,0 +1,217 @@
+package gui
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/andrebq/appshell/internal/filelock"
+)
+
+type (
+	// historyLog keeps the history as json lines, every window appends
+	// its own entries so instances sharing a workspace never overwrite
+	// each other. The log is compacted once it grows too large
+	historyLog struct {
+		mu   sync.Mutex
+		path string
+		// identity and size of the file when it was last read,
+		// compaction replaces the file so readers start over
+		info   os.FileInfo
+		offset int64
+		lines  int
+	}
+)
+
+const (
+	maxHistoryEntries = 5000
+)
+
+func newHistoryLog(path string) *historyLog {
+	return &historyLog{path: path}
+}
+
+// lock serializes access to the log between instances, a separate
+// file is used because compaction replaces the log itself
+func (l *historyLog) lock(ctx context.Context, exclusive bool) (func(), error) {
+	fd, err := os.OpenFile(l.path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := filelock.Lock(ctx, fd, exclusive); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return func() {
+		filelock.Unlock(fd)
+		fd.Close()
+	}, nil
+}
+
+func (l *historyLog) append(ctx context.Context, e historyEntry) error {
+	unlock, err := l.lock(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return l.write(e)
+}
+
+// write appends entries to the log, the exclusive lock must be held
+func (l *historyLog) write(entries ...historyEntry) error {
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	fd, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fd.Write(out.Bytes())
+	return errors.Join(err, fd.Close())
+}
+
+// read returns the entries appended since the last call, when the
+// file was replaced (or on the first call) all entries are returned
+// and reset is set
+func (l *historyLog) read(ctx context.Context) (entries []historyEntry, reset bool, err error) {
+	unlock, err := l.lock(ctx, false)
+	if err != nil {
+		return nil, false, err
+	}
+	defer unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fd, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	defer fd.Close()
+	info, err := fd.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	if l.info == nil || !os.SameFile(l.info, info) || info.Size() < l.offset {
+		reset = true
+		l.offset, l.lines = 0, 0
+	}
+	l.info = info
+	if info.Size() == l.offset {
+		return nil, reset, nil
+	}
+	if _, err := fd.Seek(l.offset, io.SeekStart); err != nil {
+		return nil, false, err
+	}
+	rd := bufio.NewReader(fd)
+	for {
+		line, err := rd.ReadBytes('\n')
+		if err == io.EOF {
+			// partial lines are read again once complete
+			break
+		} else if err != nil {
+			return nil, false, err
+		}
+		l.offset += int64(len(line))
+		l.lines++
+		var e historyEntry
+		if json.Unmarshal(bytes.TrimSpace(line), &e) == nil && e.Code != "" {
+			entries = append(entries, e)
+		}
+	}
+	return entries, reset, nil
+}
+
+// needsCompaction reports if the log has too many lines,
+// it is only accurate after read
+func (l *historyLog) needsCompaction() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lines > 2*maxHistoryEntries
+}
+
+// compact rewrites the log keeping only the most recent
+// occurrence of each command, up to maxHistoryEntries
+func (l *historyLog) compact(ctx context.Context) error {
+	unlock, err := l.lock(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	buf, err := os.ReadFile(l.path)
+	if err != nil {
+		return err
+	}
+	var entries []historyEntry
+	for _, line := range bytes.Split(buf, []byte("\n")) {
+		var e historyEntry
+		if json.Unmarshal(bytes.TrimSpace(line), &e) == nil && e.Code != "" {
+			entries = append(entries, e)
+		}
+	}
+	entries = dedupEntries(entries)
+	if len(entries) > maxHistoryEntries {
+		entries = entries[len(entries)-maxHistoryEntries:]
+	}
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), "."+filepath.Base(l.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(out.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), l.path)
+}
+
+// migrate copies the entries from the json file used by older
+// versions into the log, when the log does not exist yet. The lock
+// is held throughout, so windows opened at the same time do not
+// copy the entries twice
+func (l *historyLog) migrate(ctx context.Context, oldPath string) error {
+	unlock, err := l.lock(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if _, err := os.Stat(l.path); !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	buf, err := os.ReadFile(oldPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var saved struct {
+		Entries []historyEntry `json:"entries"`
+	}
+	if err := json.Unmarshal(buf, &saved); err != nil {
+		return err
+	}
+	if len(saved.Entries) == 0 {
+		return nil
+	}
+	return l.write(saved.Entries...)
+}
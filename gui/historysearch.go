@@ -0,0 +1,76 @@
+package gui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+type (
+	// historySearch filters the history as the query is typed,
+	// picking an entry hands its code to onPick
+	historySearch struct {
+		history *history
+		query   *widget.Entry
+		list    *widget.List
+		matches []historyMatch
+		onPick  func(code string)
+	}
+)
+
+func newHistorySearch(h *history, onPick func(code string)) *historySearch {
+	hs := &historySearch{
+		history: h,
+		query:   widget.NewEntry(),
+		onPick:  onPick,
+	}
+	hs.query.SetPlaceHolder("search history")
+	hs.query.OnChanged = func(string) { hs.refresh() }
+	hs.query.OnSubmitted = func(string) {
+		if len(hs.matches) > 0 {
+			hs.onPick(hs.matches[0].Code)
+		}
+	}
+	hs.list = widget.NewList(
+		func() int { return len(hs.matches) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			item.(*widget.Label).SetText(hs.matches[id].summary())
+		},
+	)
+	hs.list.OnSelected = func(id widget.ListItemID) {
+		hs.list.Unselect(id)
+		if id < len(hs.matches) {
+			hs.onPick(hs.matches[id].Code)
+		}
+	}
+	hs.refresh()
+	return hs
+}
+
+func (hs *historySearch) content() fyne.CanvasObject {
+	refreshBtn := widget.NewButton("Refresh", hs.refresh)
+	bar := container.NewBorder(nil, nil, nil, refreshBtn, hs.query)
+	return container.NewBorder(bar, nil, nil, nil, hs.list)
+}
+
+func (hs *historySearch) refresh() {
+	hs.matches = hs.history.search(hs.query.Text)
+	hs.list.Refresh()
+	hs.list.ScrollToTop()
+}
+
+// searchHistory works like Ctrl+R in a terminal, the best
+// match is inserted into the command entry on Enter
+func (w *win) searchHistory() {
+	var d dialog.Dialog
+	hs := newHistorySearch(&w.history, func(code string) {
+		w.nextCmd.Set(code)
+		d.Hide()
+	})
+	d = dialog.NewCustom("Search history", "Close", hs.content(), w.widget)
+	d.Resize(fyne.NewSize(640, 420))
+	d.Show()
+	w.widget.Canvas().Focus(hs.query)
+}
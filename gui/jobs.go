@@ -0,0 +1,169 @@
+package gui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/andrebq/appshell/shell"
+)
+
+type (
+	// jobsPane lists the scheduled jobs and the
+	// history of runs of the selected one
+	jobsPane struct {
+		ctx    context.Context
+		viewer jobsViewer
+
+		// jobs are refreshed from background goroutines,
+		// while the list reads them from the UI thread
+		mu       sync.Mutex
+		jobs     []shell.JobInfo
+		selected int
+
+		list    *widget.List
+		details *outputView
+		showErr func(error)
+	}
+
+	jobsViewer interface {
+		Jobs() []shell.JobInfo
+		RunJob(ctx context.Context, name string) (shell.JobRun, error)
+	}
+)
+
+func newJobsPane(ctx context.Context, viewer jobsViewer, showErr func(error)) *jobsPane {
+	p := &jobsPane{
+		ctx:      ctx,
+		viewer:   viewer,
+		selected: -1,
+		details:  newOutputView(),
+		showErr:  showErr,
+	}
+	p.list = widget.NewList(
+		func() int {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			return len(p.jobs)
+		},
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			if j, ok := p.job(id); ok {
+				item.(*widget.Label).SetText(jobSummary(j))
+			}
+		},
+	)
+	p.list.OnSelected = func(id widget.ListItemID) {
+		p.mu.Lock()
+		p.selected = id
+		p.mu.Unlock()
+		p.showRuns()
+	}
+	return p
+}
+
+func (p *jobsPane) content() fyne.CanvasObject {
+	refreshBtn := widget.NewButton("Refresh", p.refresh)
+	runBtn := widget.NewButton("Run now", p.runSelected)
+	bar := container.NewHBox(refreshBtn, runBtn)
+	split := container.NewHSplit(p.list, p.details.scroll)
+	split.SetOffset(0.35)
+	p.refresh()
+	return container.NewBorder(bar, nil, nil, nil, split)
+}
+
+// job returns a copy of the job at id
+func (p *jobsPane) job(id int) (shell.JobInfo, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if id < 0 || id >= len(p.jobs) {
+		return shell.JobInfo{}, false
+	}
+	return p.jobs[id], true
+}
+
+func (p *jobsPane) selectedJob() (shell.JobInfo, bool) {
+	p.mu.Lock()
+	id := p.selected
+	p.mu.Unlock()
+	return p.job(id)
+}
+
+func (p *jobsPane) refresh() {
+	jobs := p.viewer.Jobs()
+	current, _ := p.selectedJob()
+	p.mu.Lock()
+	p.jobs = jobs
+	p.selected = -1
+	p.mu.Unlock()
+	p.list.Refresh()
+	for i, j := range jobs {
+		if j.Name == current.Name {
+			p.list.Select(i)
+			return
+		}
+	}
+	p.list.UnselectAll()
+	p.details.clear()
+}
+
+func (p *jobsPane) runSelected() {
+	j, ok := p.selectedJob()
+	if !ok {
+		return
+	}
+	name := j.Name
+	go func() {
+		_, err := p.viewer.RunJob(p.ctx, name)
+		if err != nil {
+			p.showErr(err)
+		}
+		p.refresh()
+	}()
+}
+
+func (p *jobsPane) showRuns() {
+	p.details.clear()
+	j, ok := p.selectedJob()
+	if !ok {
+		return
+	}
+	p.details.append(styleCommand, fmt.Sprintf("%v (%v)\n%v\n\n", j.Name, j.Spec, j.Source))
+	if len(j.Runs) == 0 {
+		p.details.append(styleStdout, "no runs yet\n")
+		return
+	}
+	// most recent first
+	for i := len(j.Runs) - 1; i >= 0; i-- {
+		r := j.Runs[i]
+		p.details.append(styleCommand, fmt.Sprintf("%v took %v\n", r.Start.Format(time.DateTime), r.Duration.Round(time.Millisecond)))
+		if r.Output != "" {
+			p.details.append(styleStdout, strings.TrimSuffix(r.Output, "\n")+"\n")
+		}
+		if r.Result != "" {
+			p.details.append(styleStdout, "=> "+r.Result+"\n")
+		}
+		if r.Error != "" {
+			p.details.append(styleStderr, r.Error+"\n")
+		}
+		p.details.append(styleStdout, "\n")
+	}
+}
+
+func jobSummary(j shell.JobInfo) string {
+	state := "next " + j.Next.Format(time.DateTime)
+	if j.Running {
+		state = "running"
+	} else if j.Next.IsZero() {
+		state = "not scheduled"
+	}
+	if n := len(j.Runs); n > 0 && j.Runs[n-1].Error != "" {
+		state += ", last run failed"
+	}
+	return fmt.Sprintf("%v  [%v]  %v", j.Name, j.Spec, state)
+}
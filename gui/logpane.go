@@ -0,0 +1,166 @@
+package gui
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+type (
+	// logPane keeps the most recent records emitted by scripts
+	// and renders the ones matching the selected level
+	logPane struct {
+		mu      sync.Mutex
+		records []logLine
+		level   slog.Level
+		view    *outputView
+	}
+
+	logLine struct {
+		level slog.Level
+		text  string
+	}
+
+	// logHandler feeds the pane and forwards records to next,
+	// which usually writes them to a file
+	logHandler struct {
+		pane  *logPane
+		next  slog.Handler
+		attrs []slog.Attr
+		group string
+	}
+
+	logHandlerSetter interface {
+		LogHandler() slog.Handler
+		SetLogHandler(slog.Handler)
+	}
+)
+
+const (
+	maxLogLines = 5000
+)
+
+var (
+	logLevels = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+)
+
+func newLogPane() *logPane {
+	return &logPane{
+		level: slog.LevelDebug,
+		view:  newOutputView(),
+	}
+}
+
+func (p *logPane) content() fyne.CanvasObject {
+	levels := widget.NewSelect(logLevels, func(s string) {
+		var lvl slog.Level
+		if err := lvl.UnmarshalText([]byte(s)); err == nil {
+			p.setLevel(lvl)
+		}
+	})
+	levels.SetSelected(p.level.String())
+	clearBtn := widget.NewButton("Clear", p.clear)
+	bar := container.NewHBox(widget.NewLabel("Level"), levels, clearBtn)
+	return container.NewBorder(bar, nil, nil, nil, p.view.scroll)
+}
+
+func (p *logPane) add(level slog.Level, text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records = append(p.records, logLine{level: level, text: text})
+	if len(p.records) > maxLogLines {
+		p.records = p.records[len(p.records)-maxLogLines:]
+	}
+	if level >= p.level {
+		p.view.append(logStyle(level), text)
+	}
+}
+
+func (p *logPane) setLevel(level slog.Level) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.level = level
+	p.view.clear()
+	for _, r := range p.records {
+		if r.level >= level {
+			p.view.append(logStyle(r.level), r.text)
+		}
+	}
+}
+
+func (p *logPane) clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records = nil
+	p.view.clear()
+}
+
+func logStyle(level slog.Level) outputStyle {
+	switch {
+	case level >= slog.LevelError:
+		return styleLogError
+	case level >= slog.LevelWarn:
+		return styleLogWarn
+	case level >= slog.LevelInfo:
+		return styleStdout
+	}
+	return styleLogDebug
+}
+
+func (h *logHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	// the pane keeps everything, filtering happens when rendering
+	return true
+}
+
+func (h *logHandler) Handle(ctx context.Context, r slog.Record) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%v %-5v %v", r.Time.Format("15:04:05.000"), r.Level, r.Message)
+	for _, a := range h.attrs {
+		fmt.Fprintf(&sb, " %v=%v", a.Key, a.Value)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		fmt.Fprintf(&sb, " %v=%v", h.key(a.Key), a.Value)
+		return true
+	})
+	sb.WriteString("\n")
+	h.pane.add(r.Level, sb.String())
+
+	if h.next != nil && h.next.Enabled(ctx, r.Level) {
+		return h.next.Handle(ctx, r)
+	}
+	return nil
+}
+
+func (h *logHandler) key(k string) string {
+	if h.group == "" {
+		return k
+	}
+	return h.group + "." + k
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		c.attrs = append(c.attrs, slog.Attr{Key: h.key(a.Key), Value: a.Value})
+	}
+	if h.next != nil {
+		c.next = h.next.WithAttrs(attrs)
+	}
+	return &c
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.group = h.key(name)
+	if h.next != nil {
+		c.next = h.next.WithGroup(name)
+	}
+	return &c
+}
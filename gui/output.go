@@ -0,0 +1,181 @@
+package gui
+
+import (
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/andrebq/appshell/shell"
+)
+
+type (
+	// outputStyle selects how a piece of output is rendered
+	outputStyle int
+
+	// outputView renders the output of every command, keeping
+	// stdout, stderr and the commands themselves visually distinct,
+	// only the last maxOutputLines are retained
+	outputView struct {
+		mu     sync.Mutex
+		text   *widget.RichText
+		scroll *container.Scroll
+		lines  int
+	}
+)
+
+const (
+	maxOutputLines = 5000
+)
+
+const (
+	styleStdout outputStyle = iota
+	styleStderr
+	styleCommand
+	styleLogDebug
+	styleLogWarn
+	styleLogError
+	styleDiffAdd
+	styleDiffDel
+	styleDiffHunk
+)
+
+var (
+	outputStyles = map[outputStyle]widget.RichTextStyle{
+		styleStdout: {
+			Inline:    true,
+			ColorName: theme.ColorNameForeground,
+			TextStyle: fyne.TextStyle{Monospace: true},
+		},
+		styleStderr: {
+			Inline:    true,
+			ColorName: theme.ColorNameError,
+			TextStyle: fyne.TextStyle{Monospace: true},
+		},
+		styleCommand: {
+			Inline:    true,
+			ColorName: theme.ColorNamePrimary,
+			TextStyle: fyne.TextStyle{Monospace: true, Bold: true},
+		},
+		styleLogDebug: {
+			Inline:    true,
+			ColorName: theme.ColorNameDisabled,
+			TextStyle: fyne.TextStyle{Monospace: true},
+		},
+		styleLogWarn: {
+			Inline:    true,
+			ColorName: theme.ColorNameWarning,
+			TextStyle: fyne.TextStyle{Monospace: true},
+		},
+		styleLogError: {
+			Inline:    true,
+			ColorName: theme.ColorNameError,
+			TextStyle: fyne.TextStyle{Monospace: true, Bold: true},
+		},
+		styleDiffAdd: {
+			Inline:    true,
+			ColorName: theme.ColorNameSuccess,
+			TextStyle: fyne.TextStyle{Monospace: true},
+		},
+		styleDiffDel: {
+			Inline:    true,
+			ColorName: theme.ColorNameError,
+			TextStyle: fyne.TextStyle{Monospace: true},
+		},
+		styleDiffHunk: {
+			Inline:    true,
+			ColorName: theme.ColorNamePrimary,
+			TextStyle: fyne.TextStyle{Monospace: true, Italic: true},
+		},
+	}
+
+	// shellStyles maps the styles used by scripts to the ones
+	// known by the output view
+	shellStyles = map[shell.Style]outputStyle{
+		shell.StyleDiffAdd:  styleDiffAdd,
+		shell.StyleDiffDel:  styleDiffDel,
+		shell.StyleDiffHunk: styleDiffHunk,
+	}
+)
+
+func newOutputView() *outputView {
+	o := &outputView{
+		text: widget.NewRichText(),
+	}
+	o.text.Wrapping = fyne.TextWrapBreak
+	o.scroll = container.NewScroll(o.text)
+	return o
+}
+
+// append adds text at the end of the output and scrolls to it,
+// it is safe to call from any goroutine
+func (o *outputView) append(style outputStyle, text string) {
+	if text == "" {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.lines += strings.Count(text, "\n")
+	segs := o.text.Segments
+	if len(segs) > 0 {
+		if last, ok := segs[len(segs)-1].(*widget.TextSegment); ok && last.Style == outputStyles[style] {
+			last.Text += text
+			o.trim()
+			o.refresh()
+			return
+		}
+	}
+	o.text.Segments = append(segs, &widget.TextSegment{
+		Style: outputStyles[style],
+		Text:  text,
+	})
+	o.trim()
+	o.refresh()
+}
+
+// trim drops the oldest lines until at most maxOutputLines are left
+func (o *outputView) trim() {
+	for o.lines > maxOutputLines && len(o.text.Segments) > 0 {
+		first := o.text.Segments[0].(*widget.TextSegment)
+		idx := strings.IndexByte(first.Text, '\n')
+		if idx < 0 {
+			// the line continues in the next segment
+			o.text.Segments = o.text.Segments[1:]
+			continue
+		}
+		first.Text = first.Text[idx+1:]
+		o.lines--
+		if first.Text == "" {
+			o.text.Segments = o.text.Segments[1:]
+		}
+	}
+}
+
+// copy puts the plain text of the output in the clipboard, the
+// rich text cannot be selected
+func (o *outputView) copy(cb fyne.Clipboard) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	cb.SetContent(o.text.String())
+}
+
+func (o *outputView) refresh() {
+	o.text.Refresh()
+	o.scroll.ScrollToBottom()
+}
+
+func (o *outputView) clear() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.text.Segments = nil
+	o.lines = 0
+	o.refresh()
+}
+
+func (o *outputView) empty() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.text.Segments) == 0
+}
@@ -0,0 +1,124 @@
+package gui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/andrebq/appshell/shell"
+)
+
+type (
+	// permissions keeps the decisions the user asked to remember,
+	// the key is the capability followed by the resource
+	permissions struct {
+		mu         sync.Mutex
+		Remembered map[string]bool `json:"remembered"`
+	}
+
+	permissionPrompter interface {
+		SetPermissionPrompt(shell.PermissionPrompt)
+	}
+)
+
+func permissionKey(req shell.PermissionRequest) string {
+	return fmt.Sprintf("%v %v", req.Capability, req.Resource)
+}
+
+func (p *permissions) lookup(req shell.PermissionRequest) (allowed bool, found bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	allowed, found = p.Remembered[permissionKey(req)]
+	return
+}
+
+func (p *permissions) remember(req shell.PermissionRequest, allowed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Remembered == nil {
+		p.Remembered = make(map[string]bool)
+	}
+	p.Remembered[permissionKey(req)] = allowed
+}
+
+// askPermission is called from the goroutine running the script,
+// which stays paused until the user answers the dialog
+func (w *win) askPermission(ctx context.Context, req shell.PermissionRequest) shell.Decision {
+	if allowed, found := w.permissions.lookup(req); found {
+		if allowed {
+			return shell.AllowSession
+		}
+		return shell.Deny
+	}
+
+	answer := make(chan shell.Decision, 1)
+	remember := widget.NewCheck("Remember for this workspace", nil)
+	content := container.NewVBox(
+		widget.NewLabel(fmt.Sprintf("The script is trying to use a resource it was not granted.\n\n%v: %v", req.Capability, req.Resource)),
+		remember,
+	)
+	d := dialog.NewCustomWithoutButtons("Permission required", content, w.widget)
+	reply := func(dec shell.Decision) func() {
+		return func() {
+			select {
+			case answer <- dec:
+			default:
+			}
+			d.Hide()
+		}
+	}
+	d.SetButtons([]fyne.CanvasObject{
+		widget.NewButton("Deny", reply(shell.Deny)),
+		widget.NewButton("Allow once", reply(shell.AllowOnce)),
+		widget.NewButton("Allow for session", reply(shell.AllowSession)),
+	})
+	d.Show()
+
+	var dec shell.Decision
+	select {
+	case dec = <-answer:
+	case <-ctx.Done():
+		d.Hide()
+		return shell.Deny
+	}
+	if remember.Checked && dec != shell.AllowOnce {
+		w.permissions.remember(req, dec == shell.AllowSession)
+		w.savePermissions()
+	}
+	return dec
+}
+
+func (w *win) savePermissions() {
+	w.permissions.mu.Lock()
+	buf, err := json.Marshal(&w.permissions)
+	w.permissions.mu.Unlock()
+	if err != nil {
+		w.showError(err)
+		return
+	}
+	err = os.WriteFile(w.ws.PermissionsFile(), buf, 0600)
+	if err != nil {
+		w.showError(err)
+	}
+}
+
+func (w *win) loadPermissions() {
+	buf, err := os.ReadFile(w.ws.PermissionsFile())
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		w.showError(err)
+		return
+	}
+	err = json.Unmarshal(buf, &w.permissions)
+	if err != nil {
+		w.showError(err)
+	}
+}
@@ -0,0 +1,104 @@
+package gui
+
+import (
+	"errors"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+type (
+	secretsManager interface {
+		UnlockSecrets(passphrase string) error
+		SecretsUnlocked() bool
+		SecretNames() ([]string, error)
+		SetSecret(name, value string) error
+		DeleteSecret(name string) error
+	}
+)
+
+// manageSecrets asks for the passphrase when the vault is locked,
+// values are typed into password entries so they never reach the
+// history or the output
+func (w *win) manageSecrets(sm secretsManager) {
+	if sm.SecretsUnlocked() {
+		w.editSecrets(sm)
+		return
+	}
+	pass := widget.NewPasswordEntry()
+	dialog.ShowForm("Unlock secrets", "Unlock", "Cancel", []*widget.FormItem{
+		widget.NewFormItem("Passphrase", pass),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+		if err := sm.UnlockSecrets(pass.Text); err != nil {
+			w.showError(err)
+			return
+		}
+		w.editSecrets(sm)
+	}, w.widget)
+}
+
+func (w *win) editSecrets(sm secretsManager) {
+	names, err := sm.SecretNames()
+	if err != nil {
+		w.showError(err)
+		return
+	}
+	selected := -1
+	list := widget.NewList(
+		func() int { return len(names) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			item.(*widget.Label).SetText(names[id])
+		},
+	)
+	name := widget.NewEntry()
+	name.SetPlaceHolder("name")
+	value := widget.NewPasswordEntry()
+	value.SetPlaceHolder("value")
+	list.OnSelected = func(id widget.ListItemID) {
+		selected = id
+		name.SetText(names[id])
+		value.SetText("")
+	}
+	reload := func() {
+		names, err = sm.SecretNames()
+		if err != nil {
+			w.showError(err)
+		}
+		selected = -1
+		list.UnselectAll()
+		list.Refresh()
+		name.SetText("")
+		value.SetText("")
+	}
+	saveBtn := widget.NewButton("Save", func() {
+		if name.Text == "" || value.Text == "" {
+			w.showError(errors.New("both the name and the value are required"))
+			return
+		}
+		w.showError(sm.SetSecret(name.Text, value.Text))
+		reload()
+	})
+	deleteBtn := widget.NewButton("Delete", func() {
+		if selected < 0 || selected >= len(names) {
+			return
+		}
+		target := names[selected]
+		dialog.ShowConfirm("Delete secret", "Delete "+target+"?", func(ok bool) {
+			if ok {
+				w.showError(sm.DeleteSecret(target))
+				reload()
+			}
+		}, w.widget)
+	})
+	form := container.NewVBox(name, value, container.NewHBox(saveBtn, deleteBtn))
+	content := container.NewBorder(nil, form, nil, nil, list)
+	d := dialog.NewCustom("Secrets", "Close", content, w.widget)
+	d.Resize(fyne.NewSize(420, 360))
+	d.Show()
+}
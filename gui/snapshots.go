@@ -0,0 +1,234 @@
+package gui
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/andrebq/appshell/workspace"
+)
+
+type (
+	// snapshotStore keeps named snapshots as files in the workspace,
+	// saving a name again adds a new version instead of replacing it
+	snapshotStore struct {
+		dir       string
+		retention workspace.Retention
+	}
+
+	savedSnapshot struct {
+		Name    string    `json:"name"`
+		Version int       `json:"version"`
+		Time    time.Time `json:"time"`
+		Note    string    `json:"note,omitempty"`
+		// Data is the output of Shell.Snapshot
+		Data json.RawMessage `json:"snapshot"`
+
+		file string
+	}
+
+	// snapshotChange describes a variable that differs between
+	// two snapshots, values are formatted as json
+	snapshotChange struct {
+		name     string
+		op       string
+		old, new string
+	}
+)
+
+func newSnapshotStore(ws *workspace.Workspace) *snapshotStore {
+	return &snapshotStore{dir: ws.SnapshotsDir(), retention: ws.Config.Snapshots}
+}
+
+// list returns the snapshots, most recent first. Files which cannot be
+// read are skipped and reported in the error, along with the others
+func (st *snapshotStore) list() ([]*savedSnapshot, error) {
+	files, err := filepath.Glob(filepath.Join(st.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var out []*savedSnapshot
+	var errs []error
+	for _, f := range files {
+		buf, err := os.ReadFile(f)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var sp savedSnapshot
+		if err := json.Unmarshal(buf, &sp); err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", f, err))
+			continue
+		}
+		sp.file = f
+		out = append(out, &sp)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Time.After(out[j].Time) })
+	return out, errors.Join(errs...)
+}
+
+// save adds a version of name and removes the
+// versions not covered by the retention policy
+func (st *snapshotStore) save(name, note string, data []byte) (*savedSnapshot, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("snapshots need a name")
+	}
+	// unreadable files are reported once the snapshot is saved
+	all, listErr := st.list()
+	sp := &savedSnapshot{
+		Name:    name,
+		Version: 1,
+		Time:    time.Now(),
+		Note:    note,
+		Data:    json.RawMessage(data),
+	}
+	for _, other := range all {
+		if other.Name == name && other.Version >= sp.Version {
+			sp.Version = other.Version + 1
+		}
+	}
+	if err := st.write(sp); err != nil {
+		return nil, err
+	}
+	return sp, errors.Join(listErr, st.prune(append([]*savedSnapshot{sp}, all...)))
+}
+
+func (st *snapshotStore) write(sp *savedSnapshot) error {
+	buf, err := json.MarshalIndent(sp, "", "  ")
+	if err != nil {
+		return err
+	}
+	sp.file = filepath.Join(st.dir, fmt.Sprintf("%v-%v-v%d.json",
+		sp.Time.UTC().Format("20060102T150405.000"), fileSafe(sp.Name), sp.Version))
+	return os.WriteFile(sp.file, buf, 0600)
+}
+
+func (st *snapshotStore) remove(sp *savedSnapshot) error {
+	return os.Remove(sp.file)
+}
+
+// prune applies the retention policy to all, which must be sorted
+// most recent first. The latest version of each name is kept
+func (st *snapshotStore) prune(all []*savedSnapshot) error {
+	cutoff := time.Time{}
+	if st.retention.MaxAgeDays > 0 {
+		cutoff = time.Now().AddDate(0, 0, -st.retention.MaxAgeDays)
+	}
+	seen := map[string]int{}
+	var errs []error
+	for _, sp := range all {
+		seen[sp.Name]++
+		n := seen[sp.Name]
+		if n == 1 {
+			continue
+		}
+		tooMany := st.retention.MaxVersions > 0 && n > st.retention.MaxVersions
+		if tooMany || sp.Time.Before(cutoff) {
+			errs = append(errs, st.remove(sp))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// importLegacy keeps the single snapshot saved by older versions,
+// it is only imported while there are no named snapshots
+func (st *snapshotStore) importLegacy(path string) error {
+	all, err := st.list()
+	if err != nil || len(all) > 0 {
+		return err
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return st.write(&savedSnapshot{
+		Name:    "snapshot",
+		Version: 1,
+		Time:    info.ModTime(),
+		Note:    "imported from " + filepath.Base(path),
+		Data:    json.RawMessage(bytes.TrimSpace(buf)),
+	})
+}
+
+// label is the text shown in the lists of snapshots
+func (sp *savedSnapshot) label() string {
+	text := fmt.Sprintf("%v v%d  %v", sp.Name, sp.Version, sp.Time.Format(time.DateTime))
+	if note, _, _ := strings.Cut(strings.TrimSpace(sp.Note), "\n"); note != "" {
+		text += "  " + note
+	}
+	return text
+}
+
+// variables returns the values saved in the snapshot as indented json
+func (sp *savedSnapshot) variables() (map[string]string, error) {
+	var saved struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(sp.Data, &saved); err != nil {
+		return nil, err
+	}
+	out := make(map[string]string, len(saved.Data))
+	for k, v := range saved.Data {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, v, "", "  "); err != nil {
+			return nil, err
+		}
+		out[k] = buf.String()
+	}
+	return out, nil
+}
+
+// diffSnapshots lists the variables added, removed or changed
+// from a to b, sorted by name
+func diffSnapshots(a, b *savedSnapshot) ([]snapshotChange, error) {
+	av, err := a.variables()
+	if err != nil {
+		return nil, err
+	}
+	bv, err := b.variables()
+	if err != nil {
+		return nil, err
+	}
+	var out []snapshotChange
+	for k, before := range av {
+		after, found := bv[k]
+		switch {
+		case !found:
+			out = append(out, snapshotChange{name: k, op: "removed", old: before})
+		case before != after:
+			out = append(out, snapshotChange{name: k, op: "changed", old: before, new: after})
+		}
+	}
+	for k, after := range bv {
+		if _, found := av[k]; !found {
+			out = append(out, snapshotChange{name: k, op: "added", new: after})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out, nil
+}
+
+// fileSafe replaces the characters of name that
+// might not be valid in a file name
+func fileSafe(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,166 @@
+package gui
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrebq/appshell/workspace"
+)
+
+func newTestSnapshotStore(t *testing.T, retention workspace.Retention) (*snapshotStore, *workspace.Workspace) {
+	t.Helper()
+	ws, err := workspace.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws.Config.Snapshots = retention
+	return newSnapshotStore(ws), ws
+}
+
+func snapshotData(vars string) []byte {
+	return []byte(fmt.Sprintf(`{"version": 1, "data": {%v}}`, vars))
+}
+
+// versions lists name:version of every snapshot, most recent first
+func versions(t *testing.T, st *snapshotStore) string {
+	t.Helper()
+	all, err := st.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, sp := range all {
+		out = append(out, fmt.Sprintf("%v:%d", sp.Name, sp.Version))
+	}
+	return strings.Join(out, ",")
+}
+
+// compactJSON ignores the indentation added when snapshots are saved
+func compactJSON(t *testing.T, buf []byte) string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := json.Compact(&out, buf); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestSnapshotStoreSave(t *testing.T) {
+	st, ws := newTestSnapshotStore(t, workspace.Retention{})
+	for i, name := range []string{"a", "b", "a", " a "} {
+		if _, err := st.save(name, "", snapshotData(fmt.Sprintf(`"n": %d`, i))); err != nil {
+			t.Fatal(err)
+		}
+		// keep the times apart, the list is sorted by time
+		time.Sleep(2 * time.Millisecond)
+	}
+	if got := versions(t, st); got != "a:3,a:2,b:1,a:1" {
+		t.Errorf("got %v", got)
+	}
+	if _, err := st.save("  ", "", snapshotData("")); err == nil {
+		t.Error("saving without a name should fail")
+	}
+	// the shell reads the snapshots saved by the gui
+	buf, err := ws.LoadSnapshot("a", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compactJSON(t, buf) != compactJSON(t, snapshotData(`"n": 3`)) {
+		t.Errorf("the latest version has %s", buf)
+	}
+}
+
+func TestSnapshotStoreRetention(t *testing.T) {
+	st, _ := newTestSnapshotStore(t, workspace.Retention{MaxVersions: 2, MaxAgeDays: 1})
+	old := time.Now().AddDate(0, 0, -2)
+	for _, sp := range []*savedSnapshot{
+		{Name: "old", Version: 1, Time: old, Data: snapshotData("")},
+		{Name: "a", Version: 1, Time: old.Add(time.Hour), Data: snapshotData("")},
+	} {
+		if err := st.write(sp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := st.save("a", "", snapshotData("")); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	// the only version of old is kept regardless of its age
+	if got := versions(t, st); got != "a:4,a:3,old:1" {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestSnapshotStoreUnreadable(t *testing.T) {
+	st, ws := newTestSnapshotStore(t, workspace.Retention{})
+	if err := os.WriteFile(filepath.Join(ws.SnapshotsDir(), "broken.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sp, err := st.save("a", "", snapshotData(""))
+	if sp == nil || err == nil || !strings.Contains(err.Error(), "broken.json") {
+		t.Fatalf("expected the snapshot to be saved and the broken file reported, got %v, %v", sp, err)
+	}
+	if all, _ := st.list(); len(all) != 1 {
+		t.Errorf("got %v snapshots", len(all))
+	}
+}
+
+func TestSnapshotStoreImportLegacy(t *testing.T) {
+	st, ws := newTestSnapshotStore(t, workspace.Retention{})
+	if err := st.importLegacy(ws.LegacySnapshotFile()); err != nil {
+		t.Fatalf("a missing legacy file is not an error: %v", err)
+	}
+	if err := os.WriteFile(ws.LegacySnapshotFile(), append(snapshotData(`"x": 1`), '\n'), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := st.importLegacy(ws.LegacySnapshotFile()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	all, err := st.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Name != "snapshot" || compactJSON(t, all[0].Data) != compactJSON(t, snapshotData(`"x": 1`)) {
+		t.Fatalf("unexpected snapshots after import: %v", versions(t, st))
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	a := &savedSnapshot{Data: snapshotData(`"same": 1, "changed": [1], "removed": "x"`)}
+	b := &savedSnapshot{Data: snapshotData(`"same": 1, "changed": [2], "added": {"k": true}`)}
+	changes, err := diffSnapshots(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, fmt.Sprintf("%v %v %q %q", c.op, c.name, c.old, c.new))
+	}
+	want := []string{
+		`added added "" "{\n  \"k\": true\n}"`,
+		`changed changed "[\n  1\n]" "[\n  2\n]"`,
+		`removed removed "\"x\"" ""`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if _, err := diffSnapshots(a, &savedSnapshot{Data: json.RawMessage(`[]`)}); err == nil {
+		t.Error("expected an error for data which is not a snapshot")
+	}
+}
+
+func TestFileSafe(t *testing.T) {
+	if got := fileSafe("a b/../c-d_é"); got != "a_b____c-d_é" {
+		t.Errorf("got %v", got)
+	}
+}
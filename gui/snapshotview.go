@@ -0,0 +1,209 @@
+package gui
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// snapshot asks for a name and a note, saving
+// an existing name adds a new version of it
+func (w *win) snapshot() {
+	name := widget.NewEntry()
+	w.mu.Lock()
+	name.SetText(w.lastSnapshot)
+	w.mu.Unlock()
+	name.SetPlaceHolder("name")
+	note := widget.NewMultiLineEntry()
+	note.SetPlaceHolder("what changed, why it is worth keeping")
+	d := dialog.NewForm("Save snapshot", "Save", "Cancel", []*widget.FormItem{
+		widget.NewFormItem("Name", name),
+		widget.NewFormItem("Note", note),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+		// the session might be busy running a command
+		go func(name, note string) {
+			var buf bytes.Buffer
+			if err := w.sh.Snapshot(w.ctx, &buf); err != nil {
+				w.showError(err)
+				return
+			}
+			sp, err := w.snapshots.save(name, note, buf.Bytes())
+			if sp != nil {
+				w.mu.Lock()
+				w.lastSnapshot = sp.Name
+				w.mu.Unlock()
+				w.appendOutput(styleCommand, fmt.Sprintf("\n--- snapshot %v v%d saved ---\n", sp.Name, sp.Version))
+			}
+			w.showError(err)
+		}(name.Text, note.Text)
+	}, w.widget)
+	d.Resize(fyne.NewSize(420, 260))
+	d.Show()
+	w.widget.Canvas().Focus(name)
+}
+
+// currentSnapshot takes a snapshot of the session without saving it,
+// so saved ones can be compared with the current variables. It waits
+// for the session, so it must not be called from the UI thread
+func (w *win) currentSnapshot() (*savedSnapshot, error) {
+	var buf bytes.Buffer
+	if err := w.sh.Snapshot(w.ctx, &buf); err != nil {
+		return nil, err
+	}
+	return &savedSnapshot{Name: "current session", Time: time.Now(), Data: buf.Bytes()}, nil
+}
+
+// browseSnapshots lists the saved snapshots, any of them
+// can be restored, removed or compared with another
+func (w *win) browseSnapshots() {
+	all, err := w.snapshots.list()
+	w.showError(err)
+	var selected *savedSnapshot
+	details := widget.NewLabel("")
+	details.Wrapping = fyne.TextWrapWord
+	list := widget.NewList(
+		func() int { return len(all) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			item.(*widget.Label).SetText(all[id].label())
+		},
+	)
+	list.OnSelected = func(id widget.ListItemID) {
+		selected = all[id]
+		details.SetText(selected.Note)
+	}
+	reload := func() {
+		all, err = w.snapshots.list()
+		w.showError(err)
+		selected = nil
+		details.SetText("")
+		list.UnselectAll()
+		list.Refresh()
+	}
+	restoreBtn := widget.NewButton("Restore", func() {
+		if selected == nil {
+			return
+		}
+		target := selected
+		dialog.ShowConfirm("Restore snapshot",
+			fmt.Sprintf("Restore the variables saved in %v v%d?\nVariables with the same name are replaced, others are kept.", target.Name, target.Version),
+			func(ok bool) {
+				if !ok {
+					return
+				}
+				go func() {
+					if err := w.sh.RestoreSnapshot(w.ctx, bytes.NewReader(target.Data)); err != nil {
+						w.showError(err)
+						return
+					}
+					w.appendOutput(styleCommand, fmt.Sprintf("\n--- snapshot %v v%d restored ---\n", target.Name, target.Version))
+				}()
+			}, w.widget)
+	})
+	compareBtn := widget.NewButton("Compare…", func() {
+		if selected != nil {
+			w.compareSnapshot(selected, all)
+		}
+	})
+	deleteBtn := widget.NewButton("Delete", func() {
+		if selected == nil {
+			return
+		}
+		target := selected
+		dialog.ShowConfirm("Delete snapshot", fmt.Sprintf("Delete %v v%d?", target.Name, target.Version), func(ok bool) {
+			if ok {
+				w.showError(w.snapshots.remove(target))
+				reload()
+			}
+		}, w.widget)
+	})
+	bottom := container.NewVBox(details, container.NewHBox(restoreBtn, compareBtn, deleteBtn))
+	d := dialog.NewCustom("Snapshots", "Close", container.NewBorder(nil, bottom, nil, nil, list), w.widget)
+	d.Resize(fyne.NewSize(640, 420))
+	d.Show()
+}
+
+// compareSnapshot asks which snapshot, or the current session,
+// should be compared with base
+func (w *win) compareSnapshot(base *savedSnapshot, all []*savedSnapshot) {
+	const current = "current session"
+	options := []string{current}
+	byLabel := map[string]*savedSnapshot{}
+	for _, sp := range all {
+		if sp == base {
+			continue
+		}
+		options = append(options, sp.label())
+		byLabel[sp.label()] = sp
+	}
+	other := widget.NewSelect(options, nil)
+	other.SetSelectedIndex(0)
+	dialog.ShowForm("Compare "+base.label(), "Compare", "Cancel", []*widget.FormItem{
+		widget.NewFormItem("With", other),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+		target, found := byLabel[other.Selected]
+		if found {
+			w.showSnapshotDiff(base, target)
+			return
+		}
+		go func() {
+			target, err := w.currentSnapshot()
+			if err != nil {
+				w.showError(err)
+				return
+			}
+			w.showSnapshotDiff(base, target)
+		}()
+	}, w.widget)
+}
+
+// showSnapshotDiff opens a window with the variables that differ
+// between a and b side by side
+func (w *win) showSnapshotDiff(a, b *savedSnapshot) {
+	changes, err := diffSnapshots(a, b)
+	if err != nil {
+		w.showError(err)
+		return
+	}
+	header := func(text string) fyne.CanvasObject {
+		return widget.NewLabelWithStyle(text, fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	}
+	grid := container.NewGridWithColumns(3, header("Variable"), header(a.label()), header(b.label()))
+	counts := map[string]int{}
+	for _, c := range changes {
+		counts[c.op]++
+		name := widget.NewLabel(c.name)
+		switch c.op {
+		case "added":
+			name.Importance = widget.SuccessImportance
+		case "removed":
+			name.Importance = widget.DangerImportance
+		default:
+			name.Importance = widget.WarningImportance
+		}
+		before := widget.NewLabel(c.old)
+		before.Wrapping = fyne.TextWrapBreak
+		after := widget.NewLabel(c.new)
+		after.Wrapping = fyne.TextWrapBreak
+		grid.Add(name)
+		grid.Add(before)
+		grid.Add(after)
+	}
+	summary := widget.NewLabel(fmt.Sprintf("%d added, %d removed, %d changed",
+		counts["added"], counts["removed"], counts["changed"]))
+	dw := w.app.NewWindow(fmt.Sprintf("Diff - %v / %v", a.label(), b.label()))
+	dw.SetContent(container.NewBorder(summary, nil, nil, nil, container.NewVScroll(grid)))
+	dw.Resize(fyne.NewSize(900, 560))
+	dw.Show()
+}
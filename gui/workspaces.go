@@ -0,0 +1,76 @@
+package gui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"github.com/andrebq/appshell/workspace"
+)
+
+const (
+	prefRecentWorkspaces = "workspaces.recent"
+	maxRecentWorkspaces  = 10
+)
+
+// recentWorkspaces lists the workspaces opened before, most recent first
+func recentWorkspaces(prefs fyne.Preferences) []string {
+	return prefs.StringList(prefRecentWorkspaces)
+}
+
+func rememberWorkspace(prefs fyne.Preferences, root string) {
+	recent := []string{root}
+	for _, r := range recentWorkspaces(prefs) {
+		if r != root && len(recent) < maxRecentWorkspaces {
+			recent = append(recent, r)
+		}
+	}
+	prefs.SetStringList(prefRecentWorkspaces, recent)
+}
+
+func (w *win) mainMenu() *fyne.MainMenu {
+	var recent []*fyne.MenuItem
+	for _, r := range recentWorkspaces(w.app.Preferences()) {
+		dir := r
+		recent = append(recent, fyne.NewMenuItem(dir, func() { w.openWorkspace(dir) }))
+	}
+	recentItem := fyne.NewMenuItem("Recent workspaces", nil)
+	if len(recent) == 0 {
+		recentItem.Disabled = true
+	} else {
+		recentItem.ChildMenu = fyne.NewMenu("", recent...)
+	}
+	return fyne.NewMainMenu(fyne.NewMenu("File",
+		fyne.NewMenuItem("Open workspace…", w.chooseWorkspace),
+		recentItem,
+	))
+}
+
+// chooseWorkspace asks for a directory, starting from the current workspace
+func (w *win) chooseWorkspace() {
+	d := dialog.NewFolderOpen(func(dir fyne.ListableURI, err error) {
+		if err != nil || dir == nil {
+			w.showError(err)
+			return
+		}
+		w.openWorkspace(dir.Path())
+	}, w.widget)
+	if loc, err := storage.ListerForURI(storage.NewFileURI(w.ws.Root)); err == nil {
+		d.SetLocation(loc)
+	}
+	d.Show()
+}
+
+// openWorkspace shows dir in a new window with its own session
+func (w *win) openWorkspace(dir string) {
+	ws, err := workspace.Open(dir)
+	if err != nil {
+		w.showError(err)
+		return
+	}
+	if err := openWindow(w.appCtx, w.app, ws, w.open); err != nil {
+		w.showError(err)
+		return
+	}
+	rememberWorkspace(w.app.Preferences(), ws.Root)
+	w.widget.SetMainMenu(w.mainMenu())
+}
@@ -0,0 +1,11 @@
+// Package filelock provides advisory locks on files, used to share
+// files in the workspace between multiple appshell instances
+package filelock
+
+import (
+	"time"
+)
+
+const (
+	retryInterval = 10 * time.Millisecond
+)
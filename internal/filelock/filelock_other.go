@@ -0,0 +1,24 @@
+//go:build !unix && !windows
+
+package filelock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// ErrUnsupported is returned on platforms without advisory locks
+var ErrUnsupported = fmt.Errorf("filelock: not supported on %v: %w", runtime.GOOS, errors.ErrUnsupported)
+
+// Lock always fails with ErrUnsupported
+func Lock(ctx context.Context, f *os.File, exclusive bool) error {
+	return ErrUnsupported
+}
+
+// Unlock always fails with ErrUnsupported
+func Unlock(f *os.File) error {
+	return ErrUnsupported
+}
@@ -2,25 +2,134 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"strings"
 
+	"github.com/andrebq/appshell/cli"
 	"github.com/andrebq/appshell/gui"
 	"github.com/andrebq/appshell/shell"
+	"github.com/andrebq/appshell/workspace"
 )
 
 func main() {
+	term := flag.Bool("term", false, "Run an interactive session in the terminal instead of the GUI")
+	batch := flag.String("batch", "", "Evaluate the given script and exit")
+	logFile := flag.String("log-file", "", "Append records from the log module to the given file as JSON lines")
+	dir := flag.String("workspace", ".", "Directory with the configuration, history, snapshots, scripts and data of the session")
+	var grants grantFlags
+	flag.Var(&grants, "allow", "Grant scripts a resource, as capability:resource (eg.: rpc:api.example.com or exec:git), can be repeated.\n"+
+		"Batch mode cannot ask for permissions, so anything not granted here or in the workspace configuration is denied")
+	flag.Parse()
+
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
+	ws, err := workspace.Open(*dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, g := range grants {
+		if err := ws.Config.Allow(g); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	var logHandler slog.Handler
+	if *logFile != "" {
+		fd, err := os.OpenFile(*logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer fd.Close()
+		logHandler = slog.NewJSONHandler(fd, &slog.HandlerOptions{Level: slog.LevelDebug})
+	}
+
+	switch {
+	case *batch != "":
+		sh, err := newShell(ws, logHandler)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		code, err := os.ReadFile(*batch)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		err = cli.Batch(ctx, sh, string(code), os.Stdin, os.Stdout, os.Stderr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case *term:
+		sh, err := newShell(ws, logHandler)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		startJobs(ctx, sh)
+		cli.Run(ctx, sh, os.Stdin, os.Stdout, os.Stderr)
+	default:
+		err := gui.Run(ctx, ws, func(ctx context.Context, ws *workspace.Workspace) (gui.Shell, error) {
+			sh, err := newShell(ws, logHandler)
+			if err != nil {
+				return nil, err
+			}
+			startJobs(ctx, sh)
+			return sh, nil
+		})
+		if err != nil && ctx.Err() == nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// newShell configures a session for ws, logs go to
+// logHandler when one is given
+func newShell(ws *workspace.Workspace, logHandler slog.Handler) (*shell.Shell, error) {
 	sh := shell.New()
 	sh.EnableJSONRPCClient()
-	abs, err := filepath.Abs(".")
-	if err != nil {
-		panic(err)
+	sh.EnableHTTPClient()
+	sh.EnableHTTPServer()
+	sh.AllowImportFrom(ws.ImportDir())
+	sh.EnableFileSystem("", false)
+	sh.EnableExec()
+	sh.SetDataDir(ws.DataDir())
+	sh.ProtectDir(ws.ControlPath(""))
+	sh.SetSnapshotLoader(ws.LoadSnapshot)
+	sh.EnableJobs()
+	sh.EnableKV()
+	sh.EnableSecrets()
+	// anything else must be granted by the user when the script asks for it
+	sh.SetPolicy(ws.Policy())
+	if err := sh.SetRedaction(ws.Config.Redaction); err != nil {
+		return nil, fmt.Errorf("%v: %w", ws.Path(workspace.ConfigFile), err)
+	}
+	if logHandler != nil {
+		sh.SetLogHandler(logHandler)
 	}
-	sh.AllowImportFrom(abs)
+	return sh, nil
+}
+
+// grantFlags collects the values of -allow
+type grantFlags []string
 
-	gui.Run(ctx, sh)
+func (g *grantFlags) String() string { return strings.Join(*g, ",") }
+
+func (g *grantFlags) Set(v string) error {
+	*g = append(*g, v)
+	return nil
+}
+
+func startJobs(ctx context.Context, sh *shell.Shell) {
+	if err := sh.StartJobs(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
 }
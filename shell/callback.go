@@ -0,0 +1,75 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/d5/tengo/v2"
+	"github.com/d5/tengo/v2/parser"
+)
+
+// call invokes fn with the given arguments using the repl state.
+//
+// compiled functions (the ones declared by scripts) cannot be called
+// directly from Go, so a tiny program is assembled which pushes the function
+// and its arguments, calls it and stores the result in a reserved global.
+//
+// call must only be used while the shell is not running other code,
+// ie.: from inside a UserFunction or from a goroutine holding the session
+func (s *Shell) call(fn tengo.Object, args ...tengo.Object) (tengo.Object, error) {
+	cfn, ok := fn.(*tengo.CompiledFunction)
+	if !ok {
+		if !fn.CanCall() {
+			return tengo.UndefinedValue, fmt.Errorf("not callable: %s", fn.TypeName())
+		}
+		return fn.Call(args...)
+	}
+
+	constants := make([]tengo.Object, len(s.repl.constants), len(s.repl.constants)+len(args)+1)
+	copy(constants, s.repl.constants)
+
+	var insts []byte
+	insts = append(insts, tengo.MakeInstruction(parser.OpConstant, len(constants))...)
+	constants = append(constants, cfn)
+	for _, a := range args {
+		insts = append(insts, tengo.MakeInstruction(parser.OpConstant, len(constants))...)
+		constants = append(constants, a)
+	}
+	insts = append(insts, tengo.MakeInstruction(parser.OpCall, len(args), 0)...)
+	insts = append(insts, tengo.MakeInstruction(parser.OpSetGlobal, s.repl.ret)...)
+	insts = append(insts, tengo.MakeInstruction(parser.OpSuspend)...)
+
+	err := s.run(&tengo.Bytecode{
+		FileSet:      s.repl.fileset,
+		MainFunction: &tengo.CompiledFunction{Instructions: insts},
+		Constants:    constants,
+	})
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	ret := s.repl.globals[s.repl.ret]
+	s.repl.globals[s.repl.ret] = nil
+	if ret == nil {
+		ret = tengo.UndefinedValue
+	}
+	return ret, nil
+}
+
+// run executes the bytecode against the repl globals and aborts
+// the execution once the shell context is done
+func (s *Shell) run(bytecode *tengo.Bytecode) error {
+	machine := tengo.NewVM(bytecode, s.repl.globals, -1)
+	done := make(chan struct{})
+	defer close(done)
+	go func(ctx context.Context) {
+		select {
+		case <-ctx.Done():
+			machine.Abort()
+		case <-done:
+		}
+	}(s.ctx)
+	if err := machine.Run(); err != nil {
+		return err
+	}
+	return s.ctx.Err()
+}
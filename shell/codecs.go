@@ -0,0 +1,397 @@
+package shell
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+	"github.com/d5/tengo/v2"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	csvOptions struct {
+		comma   rune
+		comment rune
+		header  bool
+		columns []string
+	}
+)
+
+func (s *Shell) yamlModule() map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"encode": &tengo.UserFunction{
+			Name: "encode",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 1 {
+					return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+				}
+				buf, err := yaml.Marshal(tengo.ToInterface(args[0]))
+				if err != nil {
+					return tengo.UndefinedValue, err
+				}
+				return encodedString(buf)
+			},
+		},
+		"decode": &tengo.UserFunction{
+			Name: "decode",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				buf, err := decodeArg(args...)
+				if err != nil {
+					return tengo.UndefinedValue, err
+				}
+				var v any
+				if err := yaml.Unmarshal(buf, &v); err != nil {
+					return tengo.UndefinedValue, err
+				}
+				return tengo.FromInterface(normalize(v))
+			},
+		},
+	}
+}
+
+func (s *Shell) tomlModule() map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"encode": &tengo.UserFunction{
+			Name: "encode",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 1 {
+					return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+				}
+				v, ok := tengo.ToInterface(args[0]).(map[string]any)
+				if !ok {
+					return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+						Name:     "value",
+						Expected: "map",
+						Found:    args[0].TypeName(),
+					}
+				}
+				var buf bytes.Buffer
+				if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+					return tengo.UndefinedValue, err
+				}
+				return encodedString(buf.Bytes())
+			},
+		},
+		"decode": &tengo.UserFunction{
+			Name: "decode",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				buf, err := decodeArg(args...)
+				if err != nil {
+					return tengo.UndefinedValue, err
+				}
+				var v map[string]any
+				if err := toml.Unmarshal(buf, &v); err != nil {
+					return tengo.UndefinedValue, err
+				}
+				return tengo.FromInterface(normalize(v))
+			},
+		},
+	}
+}
+
+// csvModule exposes csv encoding and decoding, options are:
+// delimiter (string), comment (string), header (bool, default true)
+// and columns (array, used to select and order columns when encoding)
+func (s *Shell) csvModule() map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"encode": &tengo.UserFunction{
+			Name: "encode",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 1 && len(args) != 2 {
+					return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+				}
+				opts, err := csvOpts(args[1:]...)
+				if err != nil {
+					return tengo.UndefinedValue, err
+				}
+				rows, ok := tengo.ToInterface(args[0]).([]any)
+				if !ok {
+					return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+						Name:     "rows",
+						Expected: "array",
+						Found:    args[0].TypeName(),
+					}
+				}
+				var buf bytes.Buffer
+				if err := encodeCSV(&buf, rows, opts); err != nil {
+					return tengo.UndefinedValue, err
+				}
+				return encodedString(buf.Bytes())
+			},
+		},
+		"decode": &tengo.UserFunction{
+			Name: "decode",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 1 && len(args) != 2 {
+					return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+				}
+				buf, err := decodeArg(args[0])
+				if err != nil {
+					return tengo.UndefinedValue, err
+				}
+				opts, err := csvOpts(args[1:]...)
+				if err != nil {
+					return tengo.UndefinedValue, err
+				}
+				out := &tengo.Array{}
+				err = decodeCSV(bytes.NewReader(buf), opts, func(row tengo.Object) (bool, error) {
+					out.Value = append(out.Value, row)
+					return true, nil
+				})
+				if err != nil {
+					return tengo.UndefinedValue, err
+				}
+				return out, nil
+			},
+		},
+		"stream": &tengo.UserFunction{
+			Name:  "stream",
+			Value: s.csvStream,
+		},
+	}
+}
+
+// csvStream implements csv.stream(path, fn, [opts]), rows are read one
+// at a time from a file inside the sandbox and given to fn, which can
+// return false to stop reading
+func (s *Shell) csvStream(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	path, err := s.sandbox().pathArg(args, 0, "path")
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	fn := args[1]
+	if !fn.CanCall() {
+		return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+			Name:     "fn",
+			Expected: "callable",
+			Found:    fn.TypeName(),
+		}
+	}
+	opts, err := csvOpts(args[2:]...)
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	fd, err := os.Open(path)
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	defer fd.Close()
+	err = decodeCSV(fd, opts, func(row tengo.Object) (bool, error) {
+		ret, err := s.call(fn, row)
+		return ret != tengo.FalseValue, err
+	})
+	return tengo.UndefinedValue, err
+}
+
+func csvOpts(args ...tengo.Object) (csvOptions, error) {
+	opts := csvOptions{comma: ',', header: true}
+	if len(args) == 0 {
+		return opts, nil
+	}
+	m, ok := tengo.ToInterface(args[0]).(map[string]any)
+	if !ok {
+		return opts, tengo.ErrInvalidArgumentType{
+			Name:     "opts",
+			Expected: "map",
+			Found:    args[0].TypeName(),
+		}
+	}
+	if v, ok := m["delimiter"].(string); ok {
+		opts.comma, _ = utf8.DecodeRuneInString(v)
+	}
+	if v, ok := m["comment"].(string); ok {
+		opts.comment, _ = utf8.DecodeRuneInString(v)
+	}
+	if v, ok := m["header"].(bool); ok {
+		opts.header = v
+	}
+	if v, ok := m["columns"].([]any); ok {
+		for _, c := range v {
+			opts.columns = append(opts.columns, fmt.Sprint(c))
+		}
+	}
+	return opts, nil
+}
+
+// decodeCSV calls fn for every row, rows are maps when the input
+// has a header or arrays otherwise
+func decodeCSV(in io.Reader, opts csvOptions, fn func(tengo.Object) (bool, error)) error {
+	rd := csv.NewReader(in)
+	rd.Comma = opts.comma
+	rd.Comment = opts.comment
+	rd.FieldsPerRecord = -1
+	rd.ReuseRecord = true
+
+	var header []string
+	for {
+		record, err := rd.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if opts.header && header == nil {
+			header = append([]string(nil), record...)
+			continue
+		}
+		var row tengo.Object
+		if header != nil {
+			m := make(map[string]tengo.Object, len(header))
+			for i, col := range header {
+				if i < len(record) {
+					m[col] = &tengo.String{Value: record[i]}
+				} else {
+					m[col] = tengo.UndefinedValue
+				}
+			}
+			row = &tengo.Map{Value: m}
+		} else {
+			arr := make([]tengo.Object, len(record))
+			for i, v := range record {
+				arr[i] = &tengo.String{Value: v}
+			}
+			row = &tengo.Array{Value: arr}
+		}
+		more, err := fn(row)
+		if err != nil {
+			return err
+		} else if !more {
+			return nil
+		}
+	}
+}
+
+// encodeCSV writes rows which are either arrays or maps, for maps the
+// header comes from opts.columns or from the sorted keys of all rows
+func encodeCSV(out io.Writer, rows []any, opts csvOptions) error {
+	w := csv.NewWriter(out)
+	w.Comma = opts.comma
+
+	columns := opts.columns
+	if columns == nil {
+		seen := map[string]struct{}{}
+		for _, r := range rows {
+			if m, ok := r.(map[string]any); ok {
+				for k := range m {
+					if _, found := seen[k]; !found {
+						seen[k] = struct{}{}
+						columns = append(columns, k)
+					}
+				}
+			}
+		}
+		sort.Strings(columns)
+	}
+	if opts.header && len(columns) > 0 {
+		if err := w.Write(columns); err != nil {
+			return err
+		}
+	}
+	for _, r := range rows {
+		var record []string
+		switch r := r.(type) {
+		case map[string]any:
+			for _, c := range columns {
+				record = append(record, csvField(r[c]))
+			}
+		case []any:
+			for _, v := range r {
+				record = append(record, csvField(v))
+			}
+		default:
+			record = []string{csvField(r)}
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func csvField(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func decodeArg(args ...tengo.Object) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	buf, ok := tengo.ToByteSlice(args[0])
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "input",
+			Expected: "string|bytes",
+			Found:    args[0].TypeName(),
+		}
+	}
+	return buf, nil
+}
+
+func encodedString(buf []byte) (tengo.Object, error) {
+	if len(buf) > tengo.MaxStringLen {
+		return tengo.UndefinedValue, tengo.ErrStringLimit
+	}
+	return &tengo.String{Value: string(buf)}, nil
+}
+
+// normalize converts decoded values into types accepted by tengo.FromInterface
+func normalize(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = normalize(item)
+		}
+		return v
+	case map[any]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[fmt.Sprint(k)] = normalize(item)
+		}
+		return out
+	case []any:
+		for i, item := range v {
+			v[i] = normalize(item)
+		}
+		return v
+	case []map[string]any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = normalize(item)
+		}
+		return out
+	case nil, string, int64, int, bool, float64, []byte:
+		return v
+	case int8, int16, int32, uint, uint8, uint16, uint32, uint64:
+		var n int64
+		fmt.Sscan(fmt.Sprint(v), &n)
+		return n
+	case float32:
+		return float64(v)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case interface{ MarshalText() ([]byte, error) }:
+		// dates and times end up as RFC 3339 strings
+		if buf, err := v.MarshalText(); err == nil {
+			return string(buf)
+		}
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,505 @@
+package shell
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/d5/tengo/v2"
+)
+
+type (
+	// Style tells a StyledWriter how a piece of output should be rendered
+	Style string
+
+	// StyledWriter can be implemented by the writers given to Eval
+	// to render some output (eg.: diffs) differently from plain text
+	StyledWriter interface {
+		WriteStyled(style Style, text string) (int, error)
+	}
+
+	valueChange struct {
+		path     string
+		op       string
+		old, new tengo.Object
+	}
+
+	lineOp struct {
+		kind   byte
+		text   string
+		ai, bi int
+	}
+
+	// SnapshotLoader returns a snapshot saved by the application, in the
+	// format written by Snapshot. Version 0 asks for the latest version,
+	// errors wrap os.ErrNotExist when there is no such snapshot
+	SnapshotLoader func(name string, version int) ([]byte, error)
+)
+
+var (
+	errNotSnapshot = errors.New("not a snapshot, the data field is missing")
+)
+
+const (
+	StyleDiffAdd  = Style("diff-add")
+	StyleDiffDel  = Style("diff-del")
+	StyleDiffHunk = Style("diff-hunk")
+
+	defaultDiffContext = 3
+)
+
+func (s *Shell) diffModule() map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"values": &tengo.UserFunction{
+			Name: "values",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 2 {
+					return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+				}
+				changes := diffValues("$", args[0], args[1], nil)
+				out := &tengo.Array{Value: make([]tengo.Object, 0, len(changes))}
+				for _, c := range changes {
+					out.Value = append(out.Value, c.object())
+				}
+				return out, nil
+			},
+		},
+		"text": &tengo.UserFunction{
+			Name: "text",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				a, b, opts, err := textDiffArgs(args...)
+				if err != nil {
+					return tengo.UndefinedValue, err
+				}
+				var sb strings.Builder
+				unifiedDiff(&sb, a, b, opts)
+				return encodedString([]byte(sb.String()))
+			},
+		},
+		"print": &tengo.UserFunction{
+			Name:  "print",
+			Value: s.diffPrint,
+		},
+		"snapshot": &tengo.UserFunction{
+			Name:  "snapshot",
+			Value: s.diffSnapshot,
+		},
+	}
+}
+
+// diffPrint implements print(a, b, [opts]), strings are compared line by
+// line and other values structurally, it returns true if they differ
+func (s *Shell) diffPrint(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) < 2 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	_, aStr := args[0].(*tengo.String)
+	_, bStr := args[1].(*tengo.String)
+	if aStr && bStr {
+		a, b, opts, err := textDiffArgs(args...)
+		if err != nil {
+			return tengo.UndefinedValue, err
+		}
+		return boolObject(unifiedDiff(&s.stdout, a, b, opts)), nil
+	}
+	if len(args) != 2 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	changes := diffValues("$", args[0], args[1], nil)
+	for _, c := range changes {
+		switch c.op {
+		case "added":
+			writeStyled(&s.stdout, StyleDiffAdd, fmt.Sprintf("+ %v: %v\n", c.path, c.new))
+		case "removed":
+			writeStyled(&s.stdout, StyleDiffDel, fmt.Sprintf("- %v: %v\n", c.path, c.old))
+		default:
+			writeStyled(&s.stdout, StyleDiffHunk, fmt.Sprintf("~ %v\n", c.path))
+			writeStyled(&s.stdout, StyleDiffDel, fmt.Sprintf("  - %v\n", c.old))
+			writeStyled(&s.stdout, StyleDiffAdd, fmt.Sprintf("  + %v\n", c.new))
+		}
+	}
+	return boolObject(len(changes) > 0), nil
+}
+
+// SetSnapshotLoader lets diff.snapshot read the snapshots saved by the
+// application, which scripts cannot reach through the fs module
+func (s *Shell) SetSnapshotLoader(fn SnapshotLoader) {
+	s.snapshots = fn
+}
+
+// diffSnapshot implements snapshot(name, [version]), loading the variables
+// of a saved snapshot so they can be compared with live values. When no
+// snapshot has that name, name is a json snapshot file in the sandbox
+func (s *Shell) diffSnapshot(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	name, ok := tengo.ToString(args[0])
+	if !ok {
+		return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+			Name:     "name",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+	}
+	version := 0
+	if len(args) == 2 {
+		if version, ok = tengo.ToInt(args[1]); !ok || version < 1 {
+			return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+				Name:     "version",
+				Expected: "positive int",
+				Found:    args[1].TypeName(),
+			}
+		}
+	}
+	buf, err := s.loadSnapshot(name, version)
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	vars, err := snapshotVariables(buf)
+	if err != nil {
+		return tengo.UndefinedValue, fmt.Errorf("diff: %v: %w", name, err)
+	}
+	return tengo.FromInterface(vars)
+}
+
+func (s *Shell) loadSnapshot(name string, version int) ([]byte, error) {
+	if s.snapshots != nil {
+		buf, err := s.snapshots(name, version)
+		if err == nil || !errors.Is(err, os.ErrNotExist) || version != 0 {
+			return buf, err
+		}
+	} else if version != 0 {
+		return nil, errors.New("diff: there are no saved snapshots")
+	}
+	path, err := s.sandbox().resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// snapshotVariables decodes the output of Snapshot, either as is or
+// wrapped in the "snapshot" field like the files saved by the GUI
+func snapshotVariables(buf []byte) (map[string]any, error) {
+	var input struct {
+		Data     map[string]json.RawMessage `json:"data"`
+		Snapshot *snapshotFormat            `json:"snapshot"`
+	}
+	if err := json.Unmarshal(buf, &input); err != nil {
+		return nil, err
+	}
+	data := input.Data
+	if data == nil && input.Snapshot != nil {
+		data = input.Snapshot.Data
+	}
+	if data == nil {
+		return nil, errNotSnapshot
+	}
+	vars := make(map[string]any, len(data))
+	for k, v := range data {
+		var val any
+		if json.Unmarshal(v, &val) == nil {
+			vars[k] = val
+		}
+	}
+	return vars, nil
+}
+
+func textDiffArgs(args ...tengo.Object) (a, b string, opts map[string]any, err error) {
+	if len(args) != 2 && len(args) != 3 {
+		return "", "", nil, tengo.ErrWrongNumArguments
+	}
+	for i, dst := range []*string{&a, &b} {
+		str, ok := args[i].(*tengo.String)
+		if !ok {
+			return "", "", nil, tengo.ErrInvalidArgumentType{
+				Name:     "text",
+				Expected: "string",
+				Found:    args[i].TypeName(),
+			}
+		}
+		*dst = str.Value
+	}
+	if len(args) == 3 {
+		var ok bool
+		opts, ok = tengo.ToInterface(args[2]).(map[string]any)
+		if !ok {
+			return "", "", nil, tengo.ErrInvalidArgumentType{
+				Name:     "opts",
+				Expected: "map",
+				Found:    args[2].TypeName(),
+			}
+		}
+	}
+	return a, b, opts, nil
+}
+
+// diffValues appends the changes needed to turn a into b,
+// paths use the same syntax accepted by the query module
+func diffValues(path string, a, b tengo.Object, out []valueChange) []valueChange {
+	if am, ok := mapValue(a); ok {
+		if bm, ok := mapValue(b); ok {
+			keys := make([]string, 0, len(am)+len(bm))
+			for k := range am {
+				keys = append(keys, k)
+			}
+			for k := range bm {
+				if _, found := am[k]; !found {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				av, inA := am[k]
+				bv, inB := bm[k]
+				child := path + pathKey(k)
+				switch {
+				case !inA:
+					out = append(out, valueChange{path: child, op: "added", new: bv})
+				case !inB:
+					out = append(out, valueChange{path: child, op: "removed", old: av})
+				default:
+					out = diffValues(child, av, bv, out)
+				}
+			}
+			return out
+		}
+	}
+	if aa, ok := arrayValue(a); ok {
+		if ba, ok := arrayValue(b); ok {
+			for i := 0; i < max(len(aa), len(ba)); i++ {
+				child := fmt.Sprintf("%v[%v]", path, i)
+				switch {
+				case i >= len(aa):
+					out = append(out, valueChange{path: child, op: "added", new: ba[i]})
+				case i >= len(ba):
+					out = append(out, valueChange{path: child, op: "removed", old: aa[i]})
+				default:
+					out = diffValues(child, aa[i], ba[i], out)
+				}
+			}
+			return out
+		}
+	}
+	if !equalObjects(a, b) {
+		out = append(out, valueChange{path: path, op: "changed", old: a, new: b})
+	}
+	return out
+}
+
+func pathKey(k string) string {
+	for i := 0; i < len(k); i++ {
+		if !isNameChar(k[i]) {
+			return "['" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(k) + "']"
+		}
+	}
+	if k == "" || isDigit(k[0]) {
+		return "['" + k + "']"
+	}
+	return "." + k
+}
+
+func (c valueChange) object() tengo.Object {
+	m := map[string]tengo.Object{
+		"path": &tengo.String{Value: c.path},
+		"op":   &tengo.String{Value: c.op},
+	}
+	if c.old != nil {
+		m["old"] = c.old
+	}
+	if c.new != nil {
+		m["new"] = c.new
+	}
+	return &tengo.ImmutableMap{Value: m}
+}
+
+// unifiedDiff writes the difference between a and b in the unified format,
+// opts accepts context (lines around changes), from and to (file names),
+// it returns false when there is nothing to write
+func unifiedDiff(out io.Writer, a, b string, opts map[string]any) bool {
+	context := defaultDiffContext
+	if v, ok := opts["context"].(int64); ok && v >= 0 {
+		context = int(v)
+	}
+	from, to := "a", "b"
+	if v, ok := opts["from"].(string); ok {
+		from = v
+	}
+	if v, ok := opts["to"].(string); ok {
+		to = v
+	}
+
+	ops := diffLines(splitLines(a), splitLines(b))
+	changed := false
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		if !changed {
+			writeStyled(out, StyleDiffDel, fmt.Sprintf("--- %v\n", from))
+			writeStyled(out, StyleDiffAdd, fmt.Sprintf("+++ %v\n", to))
+			changed = true
+		}
+		start, end := max(i-context, 0), i
+		for j := i; j < len(ops) && j-end <= 2*context; j++ {
+			if ops[j].kind != ' ' {
+				end = j
+			}
+		}
+		stop := min(end+context+1, len(ops))
+		writeHunk(out, ops[start:stop])
+		i = stop
+	}
+	return changed
+}
+
+func writeHunk(out io.Writer, ops []lineOp) {
+	aStart, bStart := ops[0].ai+1, ops[0].bi+1
+	var aLen, bLen int
+	for _, op := range ops {
+		if op.kind != '+' {
+			aLen++
+		}
+		if op.kind != '-' {
+			bLen++
+		}
+	}
+	if aLen == 0 {
+		aStart--
+	}
+	if bLen == 0 {
+		bStart--
+	}
+	writeStyled(out, StyleDiffHunk, fmt.Sprintf("@@ -%v,%v +%v,%v @@\n", aStart, aLen, bStart, bLen))
+	for _, op := range ops {
+		line := string(op.kind) + op.text + "\n"
+		switch op.kind {
+		case '+':
+			writeStyled(out, StyleDiffAdd, line)
+		case '-':
+			writeStyled(out, StyleDiffDel, line)
+		default:
+			io.WriteString(out, line)
+		}
+	}
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes the shortest edit script between a and b using
+// the linear space variant of the Myers algorithm, which splits the
+// problem at the middle snake of the edit path
+func diffLines(a, b []string) []lineOp {
+	var ops []lineOp
+	diffRange(a, b, 0, len(a), 0, len(b), &ops)
+	return ops
+}
+
+// diffRange appends to ops the edit script between a[a0:a1] and b[b0:b1]
+func diffRange(a, b []string, a0, a1, b0, b1 int, ops *[]lineOp) {
+	for a0 < a1 && b0 < b1 && a[a0] == b[b0] {
+		*ops = append(*ops, lineOp{kind: ' ', text: a[a0], ai: a0, bi: b0})
+		a0++
+		b0++
+	}
+	suffix := 0
+	for a1-suffix > a0 && b1-suffix > b0 && a[a1-suffix-1] == b[b1-suffix-1] {
+		suffix++
+	}
+	a1, b1 = a1-suffix, b1-suffix
+	switch {
+	case a0 == a1:
+		for y := b0; y < b1; y++ {
+			*ops = append(*ops, lineOp{kind: '+', text: b[y], ai: a0, bi: y})
+		}
+	case b0 == b1:
+		for x := a0; x < a1; x++ {
+			*ops = append(*ops, lineOp{kind: '-', text: a[x], ai: x, bi: b0})
+		}
+	default:
+		// without common prefix and suffix, the edit script has at
+		// least two edits, so both halves are smaller problems
+		x, y, u, v := middleSnake(a[a0:a1], b[b0:b1])
+		diffRange(a, b, a0, a0+x, b0, b0+y, ops)
+		for i := 0; i < u-x; i++ {
+			*ops = append(*ops, lineOp{kind: ' ', text: a[a0+x+i], ai: a0 + x + i, bi: b0 + y + i})
+		}
+		diffRange(a, b, a0+u, a1, b0+v, b1, ops)
+	}
+	for i := 0; i < suffix; i++ {
+		*ops = append(*ops, lineOp{kind: ' ', text: a[a1+i], ai: a1 + i, bi: b1 + i})
+	}
+}
+
+// middleSnake searches the shortest edit path from both ends at the same
+// time and returns the snake, from (x, y) to (u, v), where they meet
+func middleSnake(a, b []string) (x, y, u, v int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	limit := (n + m + 1) / 2
+	offset := limit + 1
+	// forward holds the furthest x on each diagonal k = x - y, backward
+	// the same counting from the end of both sequences
+	forward := make([]int, 2*limit+3)
+	backward := make([]int, 2*limit+3)
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y = x - k
+			u, v = x, y
+			for u < n && v < m && a[u] == b[v] {
+				u++
+				v++
+			}
+			forward[offset+k] = u
+			// the backward diagonal matching k is delta - k
+			if odd && delta-k >= -(d-1) && delta-k <= d-1 && u+backward[offset+delta-k] >= n {
+				return x, y, u, v
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			var bx int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				bx = backward[offset+k+1]
+			} else {
+				bx = backward[offset+k-1] + 1
+			}
+			by := bx - k
+			sx, sy := bx, by
+			for bx < n && by < m && a[n-bx-1] == b[m-by-1] {
+				bx++
+				by++
+			}
+			backward[offset+k] = bx
+			if !odd && delta-k >= -d && delta-k <= d && bx+forward[offset+delta-k] >= n {
+				return n - bx, m - by, n - sx, m - sy
+			}
+		}
+	}
+	// unreachable: the paths always meet within limit steps
+	return 0, 0, 0, 0
+}
+
+// writeStyled uses the style when out supports it
+func writeStyled(out io.Writer, style Style, text string) (int, error) {
+	if sw, ok := out.(StyledWriter); ok {
+		return sw.WriteStyled(style, text)
+	}
+	return io.WriteString(out, text)
+}
@@ -0,0 +1,194 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// checkEditScript verifies ops turns a into b, using the
+// indexes recorded in each operation
+func checkEditScript(t *testing.T, a, b []string, ops []lineOp) (edits int) {
+	t.Helper()
+	x, y := 0, 0
+	for _, op := range ops {
+		if op.ai != x || op.bi != y {
+			t.Fatalf("op %+v at unexpected position (%v, %v)", op, x, y)
+		}
+		switch op.kind {
+		case ' ':
+			if a[x] != op.text || b[y] != op.text {
+				t.Fatalf("op %+v does not match the input", op)
+			}
+			x++
+			y++
+		case '-':
+			if a[x] != op.text {
+				t.Fatalf("op %+v does not match a", op)
+			}
+			x++
+			edits++
+		case '+':
+			if b[y] != op.text {
+				t.Fatalf("op %+v does not match b", op)
+			}
+			y++
+			edits++
+		}
+	}
+	if x != len(a) || y != len(b) {
+		t.Fatalf("edit script stops at (%v, %v), expected (%v, %v)", x, y, len(a), len(b))
+	}
+	return edits
+}
+
+// minEdits is the textbook quadratic solution, used as reference
+func minEdits(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				cur[j] = prev[j-1]
+			} else {
+				cur[j] = 1 + min(prev[j], cur[j-1])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		edits int
+	}{
+		{"", "", 0},
+		{"a", "a", 0},
+		{"", "a b c", 3},
+		{"a b c", "", 3},
+		{"a b c", "a x c", 2},
+		{"a b c a b b a", "c b a b a c", 5},
+		{"x", "y", 2},
+		{"a a a", "a a", 1},
+		{"a b c d e", "e d c b a", 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			a, b := strings.Fields(tt.a), strings.Fields(tt.b)
+			if edits := checkEditScript(t, a, b, diffLines(a, b)); edits != tt.edits {
+				t.Fatalf("expected %v edits, got %v", tt.edits, edits)
+			}
+		})
+	}
+}
+
+func TestDiffLinesRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	gen := func() []string {
+		out := make([]string, rnd.Intn(40))
+		for i := range out {
+			out[i] = string(rune('a' + rnd.Intn(4)))
+		}
+		return out
+	}
+	for i := 0; i < 2000; i++ {
+		a, b := gen(), gen()
+		edits := checkEditScript(t, a, b, diffLines(a, b))
+		if want := minEdits(a, b); edits != want {
+			t.Fatalf("%v / %v: expected %v edits, got %v", a, b, want, edits)
+		}
+	}
+}
+
+func TestDiffLinesMemory(t *testing.T) {
+	const lines = 3000
+	a, b := make([]string, lines), make([]string, lines)
+	for i := range a {
+		a[i] = fmt.Sprintf("a%v", i)
+		b[i] = fmt.Sprintf("b%v", i)
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	ops := diffLines(a, b)
+	runtime.ReadMemStats(&after)
+	checkEditScript(t, a, b, ops)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 16<<20 {
+		t.Fatalf("diff of %v lines allocated %v MiB", lines, alloc>>20)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	var sb strings.Builder
+	if unifiedDiff(&sb, "a\nb\nc\n", "a\nb\nc\n", nil) || sb.Len() != 0 {
+		t.Fatalf("equal texts produced a diff: %q", sb.String())
+	}
+	changed := unifiedDiff(&sb, "a\nb\nc\nd\ne\nf\ng\nh\n", "a\nB\nc\nd\ne\nf\ng\nH\n", map[string]any{"context": int64(1), "from": "old", "to": "new"})
+	want := "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n@@ -7,2 +7,2 @@\n g\n-h\n+H\n"
+	if !changed || sb.String() != want {
+		t.Fatalf("unexpected diff:\n%v", sb.String())
+	}
+}
+
+func TestDiffSnapshot(t *testing.T) {
+	src := newTestShell(t)
+	if _, err := eval(t, src, `a := 1; b := {c: "x"}`); err != nil {
+		t.Fatal(err)
+	}
+	var raw bytes.Buffer
+	if err := src.Snapshot(context.Background(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	wrapped := fmt.Sprintf(`{"name": "saved", "version": 2, "snapshot": %s}`, raw.Bytes())
+	saved := map[int]string{1: `{"data": {"a": 0}}`, 2: raw.String()}
+	loader := func(name string, version int) ([]byte, error) {
+		if name != "saved" {
+			return nil, fmt.Errorf("snapshot %v: %w", name, os.ErrNotExist)
+		}
+		if version == 0 {
+			version = 2
+		}
+		data, found := saved[version]
+		if !found {
+			return nil, fmt.Errorf("snapshot %v v%d: %w", name, version, os.ErrNotExist)
+		}
+		return []byte(data), nil
+	}
+
+	runScripts(t, func(s *Shell) {
+		s.EnableFileSystem("", false)
+		s.SetSnapshotLoader(loader)
+		for name, content := range map[string]string{
+			"raw.json":     raw.String(),
+			"wrapped.json": wrapped,
+			"other.json":   `{"name": "x"}`,
+			"broken.json":  `{`,
+		} {
+			if err := os.WriteFile(filepath.Join(s.importsDir, name), []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}, `diff := import("diff"); a := 1; b := {c: "x"}`, []scriptTest{
+		{"named", `len(diff.values(diff.snapshot("saved"), {a: a, b: b}))`, "0", false},
+		{"named version", `diff.snapshot("saved", 1).a`, "0", false},
+		{"missing version", `diff.snapshot("saved", 3)`, "", true},
+		{"invalid version", `diff.snapshot("saved", 0)`, "", true},
+		{"file", `diff.snapshot("raw.json").b.c`, "x", false},
+		{"wrapped file", `diff.snapshot("wrapped.json").b.c`, "x", false},
+		{"not a snapshot", `diff.snapshot("other.json")`, "", true},
+		{"invalid json", `diff.snapshot("broken.json")`, "", true},
+		{"missing", `diff.snapshot("missing")`, "", true},
+		{"outside the sandbox", `diff.snapshot("../raw.json")`, "", true},
+	})
+}
@@ -0,0 +1,292 @@
+package shell
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/d5/tengo/v2"
+)
+
+type (
+	// eventBus delivers events to the handlers registered by scripts,
+	// one event at a time and in the order they were published
+	eventBus struct {
+		mu       sync.Mutex
+		handlers map[string][]*eventHandler
+		queue    []event
+		draining bool
+		hook     func(topic string, payload any)
+	}
+
+	event struct {
+		topic   string
+		payload tengo.Object
+		// emitted is set for events coming from scripts,
+		// which are also forwarded to the host
+		emitted bool
+	}
+
+	// eventHandler is returned by events.on, closing it
+	// (or resetting the session) unregisters the handler
+	eventHandler struct {
+		bus    *eventBus
+		topic  string
+		fn     tengo.Object
+		ctx    context.Context
+		cancel context.CancelFunc
+		once   sync.Once
+	}
+)
+
+const (
+	maxPendingEvents = 1024
+)
+
+var (
+	// ErrEventQueueFull is returned when events are published
+	// faster than the handlers can process them
+	ErrEventQueueFull = errors.New("events: too many pending events")
+)
+
+func (s *Shell) eventsModule() map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"on": &tengo.UserFunction{
+			Name:  "on",
+			Value: s.eventsOn,
+		},
+		"off": &tengo.UserFunction{
+			Name:  "off",
+			Value: s.eventsOff,
+		},
+		"emit": &tengo.UserFunction{
+			Name:  "emit",
+			Value: s.eventsEmit,
+		},
+	}
+}
+
+// Publish queues an event for the handlers registered with events.on,
+// handlers run inside the session once no evaluation is running.
+//
+// payload is converted as if it was encoded to json and decoded back,
+// ErrEventQueueFull is returned when the scripts are not keeping up
+func (s *Shell) Publish(topic string, payload any) error {
+	obj, err := eventPayload(payload)
+	if err != nil {
+		return err
+	}
+	return s.events.push(s, event{topic: topic, payload: obj})
+}
+
+// OnEvent registers a function which receives the events
+// emitted by scripts with events.emit
+func (s *Shell) OnEvent(fn func(topic string, payload any)) {
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+	s.events.hook = fn
+}
+
+// eventsOn implements on(topic, fn), fn is called with the payload
+// of every event published to topic
+func (s *Shell) eventsOn(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 2 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	topic, err := topicArg(args[0])
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	fn, err := callableArg(args[1], "fn")
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	h := &eventHandler{bus: &s.events, topic: topic, fn: fn}
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+	untrack := s.resources.track(h)
+	context.AfterFunc(h.ctx, untrack)
+	s.events.subscribe(h)
+	return h.object(), nil
+}
+
+// eventsOff implements off(topic), removing all handlers of topic
+func (s *Shell) eventsOff(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	topic, err := topicArg(args[0])
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	s.events.mu.Lock()
+	handlers := s.events.handlers[topic]
+	s.events.mu.Unlock()
+	for _, h := range handlers {
+		h.Close()
+	}
+	return &tengo.Int{Value: int64(len(handlers))}, nil
+}
+
+// eventsEmit implements emit(topic, [payload]), the event is delivered
+// after the current evaluation finishes
+func (s *Shell) eventsEmit(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	topic, err := topicArg(args[0])
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	var payload tengo.Object = tengo.UndefinedValue
+	if len(args) == 2 {
+		payload = args[1].Copy()
+	}
+	return tengo.UndefinedValue, s.events.push(s, event{topic: topic, payload: payload, emitted: true})
+}
+
+func topicArg(arg tengo.Object) (string, error) {
+	topic, ok := arg.(*tengo.String)
+	if !ok {
+		return "", tengo.ErrInvalidArgumentType{
+			Name:     "topic",
+			Expected: "string",
+			Found:    arg.TypeName(),
+		}
+	}
+	if topic.Value == "" {
+		return "", errors.New("events: topic cannot be empty")
+	}
+	return topic.Value, nil
+}
+
+func eventPayload(payload any) (tengo.Object, error) {
+	if obj, ok := payload.(tengo.Object); ok {
+		return obj.Copy(), nil
+	}
+	if payload == nil {
+		return tengo.UndefinedValue, nil
+	}
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("events: invalid payload: %w", err)
+	}
+	val, err := decodeJSONNumbers(buf)
+	if err != nil {
+		return nil, err
+	}
+	return tengo.FromInterface(normalize(val))
+}
+
+func (b *eventBus) subscribe(h *eventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.handlers == nil {
+		b.handlers = make(map[string][]*eventHandler)
+	}
+	b.handlers[h.topic] = append(b.handlers[h.topic], h)
+}
+
+func (b *eventBus) unsubscribe(h *eventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	handlers := b.handlers[h.topic]
+	for i, v := range handlers {
+		if v == h {
+			handlers = append(handlers[:i:i], handlers[i+1:]...)
+			break
+		}
+	}
+	if len(handlers) == 0 {
+		delete(b.handlers, h.topic)
+	} else {
+		b.handlers[h.topic] = handlers
+	}
+}
+
+// push queues ev and starts delivering the queue if needed,
+// a single goroutine drains it to keep events ordered
+func (b *eventBus) push(s *Shell, ev event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.queue) >= maxPendingEvents {
+		return ErrEventQueueFull
+	}
+	b.queue = append(b.queue, ev)
+	if !b.draining {
+		b.draining = true
+		go b.drain(s)
+	}
+	return nil
+}
+
+func (b *eventBus) drain(s *Shell) {
+	for {
+		b.mu.Lock()
+		if len(b.queue) == 0 {
+			b.draining = false
+			b.mu.Unlock()
+			return
+		}
+		ev := b.queue[0]
+		b.queue[0] = event{}
+		b.queue = b.queue[1:]
+		handlers := append([]*eventHandler(nil), b.handlers[ev.topic]...)
+		hook := b.hook
+		b.mu.Unlock()
+
+		if ev.emitted && hook != nil {
+			hook(ev.topic, tengo.ToInterface(ev.payload))
+		}
+		for _, h := range handlers {
+			h.deliver(s, ev.payload.Copy())
+		}
+	}
+}
+
+// clear drops the events which were not delivered yet
+func (b *eventBus) clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.queue = nil
+}
+
+func (h *eventHandler) deliver(s *Shell, payload tengo.Object) {
+	s.background(h.ctx, func() error {
+		if h.ctx.Err() != nil {
+			// removed while waiting for the session
+			return nil
+		}
+		_, err := s.call(h.fn, payload)
+		if err != nil {
+			fmt.Fprintf(&s.stderr, "events: handler for %q failed: %v\n", h.topic, err)
+		}
+		return err
+	})
+}
+
+func (h *eventHandler) Close() error {
+	h.once.Do(func() {
+		h.cancel()
+		h.bus.unsubscribe(h)
+	})
+	return nil
+}
+
+func (h *eventHandler) object() tengo.Object {
+	return &tengo.ImmutableMap{Value: map[string]tengo.Object{
+		"off": &tengo.UserFunction{
+			Name: "off",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				return tengo.UndefinedValue, h.Close()
+			},
+		},
+		"active": &tengo.UserFunction{
+			Name: "active",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				return boolObject(h.ctx.Err() == nil), nil
+			},
+		},
+	}}
+}
@@ -0,0 +1,176 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEventsOrder(t *testing.T) {
+	s := newTestShell(t)
+	_, err := eval(t, s, `events := import("events")
+got := []; events.on("n", func(v) { got = append(got, v) })
+inOrder := func() { for i, v in got { if v != i { return false } }; return true }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const count = 200
+	for i := 0; i < count; i++ {
+		if err := s.Publish("n", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, s, `len(got)`, fmt.Sprint(count))
+	waitFor(t, s, `inOrder()`, "true")
+}
+
+func TestEventsPayload(t *testing.T) {
+	s := newTestShell(t)
+	_, err := eval(t, s, `events := import("events")
+got := undefined; seen := 0; events.on("p", func(v) { got = v; seen++ })`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type payload struct {
+		Name  string   `json:"name"`
+		Count int      `json:"count"`
+		Tags  []string `json:"tags"`
+	}
+	tests := []struct {
+		payload any
+		code    string
+		want    string
+	}{
+		{payload{Name: "a", Count: 2, Tags: []string{"x"}}, `[got.name, got.count + 1, got.tags]`, `["a", 3, ["x"]]`},
+		{map[string]any{"ratio": 0.5}, `got.ratio * 2`, "1"},
+		{nil, `is_undefined(got)`, "true"},
+	}
+	for i, tt := range tests {
+		if err := s.Publish("p", tt.payload); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, s, `seen`, fmt.Sprint(i+1))
+		waitFor(t, s, tt.code, tt.want)
+	}
+	if err := s.Publish("p", func() {}); err == nil {
+		t.Error("publishing a func should fail")
+	}
+}
+
+func TestEventsEmit(t *testing.T) {
+	s := newTestShell(t)
+	var mu sync.Mutex
+	var hooked []string
+	s.OnEvent(func(topic string, payload any) {
+		mu.Lock()
+		defer mu.Unlock()
+		hooked = append(hooked, fmt.Sprintf("%v=%v", topic, payload))
+	})
+	_, err := eval(t, s, `events := import("events")
+got := []; events.on("ping", func(v) { got = append(got, v); if v < 3 { events.emit("ping", v + 1) } })
+events.emit("ping", 1)
+len(got)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, s, `got`, "[1, 2, 3]")
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(hooked, ","); got != "ping=1,ping=2,ping=3" {
+		t.Errorf("the host got %v", got)
+	}
+}
+
+func TestEventsOff(t *testing.T) {
+	s := newTestShell(t)
+	var stderr syncBuffer
+	s.SetOutput(&syncBuffer{}, &stderr)
+	_, err := eval(t, s, `events := import("events")
+a := 0; b := 0; c := 0
+ha := events.on("a", func(v) { a++ })
+events.on("b", func(v) { b++ }); events.on("b", func(v) { b++ })
+events.on("c", func(v) { c++; return undefined.missing() })`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, s, `ha.off(); ha.active()`, "false")
+	waitFor(t, s, `events.off("b")`, "2")
+	for _, topic := range []string{"a", "b", "c", "c"} {
+		if err := s.Publish(topic, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a failing handler does not stop the delivery of the next events
+	waitFor(t, s, `c`, "2")
+	waitFor(t, s, `[a, b]`, "[0, 0]")
+	if !strings.Contains(stderr.String(), `events: handler for "c" failed`) {
+		t.Errorf("the failure was not reported: %q", stderr.String())
+	}
+}
+
+func TestEventsArgs(t *testing.T) {
+	runScripts(t, nil, `events := import("events")`, []scriptTest{
+		{name: "empty topic", code: `events.on("", func(v) {})`, fail: true},
+		{name: "topic type", code: `events.on(1, func(v) {})`, fail: true},
+		{name: "not callable", code: `events.on("a", 1)`, fail: true},
+		{name: "emit without topic", code: `events.emit()`, fail: true},
+		{name: "off without handlers", code: `events.off("a")`, want: "0"},
+	})
+}
+
+func TestEventsQueueFull(t *testing.T) {
+	s := newTestShell(t)
+	if _, err := eval(t, s, `events := import("events"); n := 0; events.on("n", func(v) { n++ })`); err != nil {
+		t.Fatal(err)
+	}
+	// handlers cannot run while the session is busy
+	s.session.Lock()
+	published := 0
+	var err error
+	for ; published <= maxPendingEvents+1; published++ {
+		if err = s.Publish("n", published); err != nil {
+			break
+		}
+	}
+	s.session.Unlock()
+	if !errors.Is(err, ErrEventQueueFull) {
+		t.Fatalf("expected ErrEventQueueFull, got %v", err)
+	}
+	// the drain goroutine might have taken the first event already
+	if published != maxPendingEvents && published != maxPendingEvents+1 {
+		t.Errorf("the queue was full after %v events", published)
+	}
+	waitFor(t, s, `n`, fmt.Sprint(published))
+}
+
+func TestEventsReset(t *testing.T) {
+	s := newTestShell(t)
+	var stdout syncBuffer
+	s.SetOutput(&stdout, &syncBuffer{})
+	if _, err := eval(t, s, `events := import("events"); fmt := import("fmt"); events.on("n", func(v) { fmt.print(v) })`); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reset(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s.events.mu.Lock()
+	left := len(s.events.handlers)
+	s.events.mu.Unlock()
+	if left != 0 {
+		t.Errorf("%v topics still have handlers after reset", left)
+	}
+	// a handler registered after the reset gets the event, the old one does not
+	if _, err := eval(t, s, `events := import("events"); got := 0; events.on("n", func(v) { got = v })`); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Publish("n", 7); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, s, `got`, "7")
+	if out := stdout.String(); out != "" {
+		t.Errorf("the handler removed by reset printed %q", out)
+	}
+}
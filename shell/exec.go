@@ -0,0 +1,204 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/d5/tengo/v2"
+)
+
+// EnableExec exposes the exec module to scripts.
+//
+// Only executables explicitly granted (via Policy.Executables or the
+// permission prompt) can be executed, and they always run inside
+// the fs sandbox root.
+func (s *Shell) EnableExec() {
+	s.execMod = map[string]tengo.Object{
+		"run": &tengo.UserFunction{Name: "run", Value: s.execRun},
+	}
+}
+
+// execRun implements exec.run(name, [opts]), opts might contain:
+// args (array), env (map), dir (string), stdin (string|bytes),
+// timeout (duration) and quiet (bool)
+func (s *Shell) execRun(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	name, ok := tengo.ToString(args[0])
+	if !ok {
+		return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+			Name:     "name",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+	}
+	opts := map[string]tengo.Object{}
+	if len(args) == 2 {
+		m, ok := args[1].(*tengo.Map)
+		if !ok {
+			return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+				Name:     "opts",
+				Expected: "map",
+				Found:    args[1].TypeName(),
+			}
+		}
+		opts = m.Value
+	}
+
+	path, err := lookExecutable(name)
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	if err := s.request(CapExec, path); err != nil {
+		return tengo.UndefinedValue, err
+	}
+
+	ctx := s.ctx
+	if v, found := opts["timeout"]; found {
+		timeout, ok := toDuration(v)
+		if !ok {
+			return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+				Name:     "timeout",
+				Expected: "duration (int milliseconds or string)",
+				Found:    v.TypeName(),
+			}
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Args = []string{name}
+	if v, found := opts["args"]; found {
+		arr, ok := tengo.ToInterface(v).([]any)
+		if !ok {
+			return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+				Name:     "args",
+				Expected: "array",
+				Found:    v.TypeName(),
+			}
+		}
+		for _, a := range arr {
+			cmd.Args = append(cmd.Args, fmt.Sprint(a))
+		}
+	}
+
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "HOME=" + os.Getenv("HOME")}
+	if v, found := opts["env"]; found {
+		env, ok := v.(*tengo.Map)
+		if !ok {
+			return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+				Name:     "env",
+				Expected: "map",
+				Found:    v.TypeName(),
+			}
+		}
+		for k, v := range env.Value {
+			str, _ := tengo.ToString(v)
+			cmd.Env = append(cmd.Env, k+"="+str)
+		}
+	}
+
+	dir := "."
+	if v, found := opts["dir"]; found {
+		dir, ok = tengo.ToString(v)
+		if !ok {
+			return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+				Name:     "dir",
+				Expected: "string",
+				Found:    v.TypeName(),
+			}
+		}
+	}
+	cmd.Dir, err = s.sandbox().resolve(dir)
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+
+	if v, found := opts["stdin"]; found {
+		in, ok := tengo.ToByteSlice(v)
+		if !ok {
+			return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+				Name:     "stdin",
+				Expected: "string|bytes",
+				Found:    v.TypeName(),
+			}
+		}
+		cmd.Stdin = bytes.NewReader(in)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if v, found := opts["quiet"]; !found || v.IsFalsy() {
+		// stream the output while the process is running
+		cmd.Stdout = io.MultiWriter(&stdout, &s.stdout)
+		cmd.Stderr = io.MultiWriter(&stderr, &s.stderr)
+	}
+
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if ctx.Err() != nil {
+		return tengo.UndefinedValue, fmt.Errorf("exec: %v: %w", name, ctx.Err())
+	} else if err != nil && !errors.As(err, &exitErr) {
+		return tengo.UndefinedValue, err
+	}
+	if stdout.Len() > tengo.MaxStringLen || stderr.Len() > tengo.MaxStringLen {
+		return tengo.UndefinedValue, tengo.ErrStringLimit
+	}
+	return &tengo.Map{Value: map[string]tengo.Object{
+		"stdout": &tengo.String{Value: stdout.String()},
+		"stderr": &tengo.String{Value: stderr.String()},
+		"code":   &tengo.Int{Value: int64(cmd.ProcessState.ExitCode())},
+	}}, nil
+}
+
+// lookExecutable returns the absolute path for name, relative paths
+// are rejected since they would depend on the process working directory
+func lookExecutable(name string) (string, error) {
+	if !filepath.IsAbs(name) && strings.ContainsRune(name, filepath.Separator) {
+		return "", fmt.Errorf("exec: relative paths are not allowed: %v", name)
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(path)
+}
+
+// sandbox returns the fs sandbox, when the fs module is not enabled
+// a read-only sandbox rooted at the imports directory is used
+func (s *Shell) sandbox() *sandboxFS {
+	if s.fs != nil {
+		return s.fs
+	}
+	return &sandboxFS{
+		root:      func() string { return s.importsDir },
+		protected: func() []string { return s.protected },
+		readOnly:  true,
+		allow:     s.allow,
+		request:   s.request,
+	}
+}
+
+// toDuration accepts integers (milliseconds) or strings
+// parsed by time.ParseDuration
+func toDuration(o tengo.Object) (time.Duration, bool) {
+	switch o := o.(type) {
+	case *tengo.Int:
+		return time.Duration(o.Value) * time.Millisecond, true
+	case *tengo.String:
+		d, err := time.ParseDuration(o.Value)
+		return d, err == nil
+	}
+	return 0, false
+}
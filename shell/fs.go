@@ -0,0 +1,408 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/d5/tengo/v2"
+)
+
+type (
+	// sandboxFS resolves every path inside root, paths which escape the
+	// root (either via .. or symlinks) are rejected
+	sandboxFS struct {
+		root func() string
+		// protected directories are rejected even inside root
+		protected func() []string
+		readOnly  bool
+		allow     func(Capability, string) error
+		request   func(Capability, string) error
+	}
+)
+
+var (
+	errFSEscape   = errors.New("fs: path escapes the sandbox root")
+	errFSReadOnly = errors.New("fs: sandbox is read-only")
+	errFSNoRoot   = errors.New("fs: sandbox root is not configured")
+	errFSProtect  = errors.New("fs: path is reserved for appshell")
+)
+
+// EnableFileSystem exposes the fs module to scripts, every path is resolved
+// inside root. When root is empty, the directory passed to AllowImportFrom
+// is used instead.
+func (s *Shell) EnableFileSystem(root string, readOnly bool) {
+	s.fs = &sandboxFS{
+		root: func() string {
+			if root != "" {
+				return root
+			}
+			return s.importsDir
+		},
+		protected: func() []string { return s.protected },
+		readOnly:  readOnly,
+		allow:     s.allow,
+		request:   s.request,
+	}
+	s.fsMod = s.fs.module()
+}
+
+// ProtectDir keeps scripts from reaching dir using the fs and exec
+// modules, even when it is inside the sandbox root. It is meant for
+// files the host trusts, like remembered permissions or jobs
+func (s *Shell) ProtectDir(dir string) {
+	s.protected = append(s.protected, dir)
+}
+
+func (f *sandboxFS) module() map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"read":   &tengo.UserFunction{Name: "read", Value: f.read},
+		"write":  &tengo.UserFunction{Name: "write", Value: f.write},
+		"list":   &tengo.UserFunction{Name: "list", Value: f.list},
+		"stat":   &tengo.UserFunction{Name: "stat", Value: f.stat},
+		"glob":   &tengo.UserFunction{Name: "glob", Value: f.glob},
+		"mkdir":  &tengo.UserFunction{Name: "mkdir", Value: f.mkdir},
+		"remove": &tengo.UserFunction{Name: "remove", Value: f.remove},
+	}
+}
+
+func (f *sandboxFS) realRoot() (string, error) {
+	root := f.root()
+	if root == "" {
+		return "", errFSNoRoot
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(root)
+}
+
+// resolve returns the absolute path for name, name is always
+// interpreted as relative to the sandbox root
+func (f *sandboxFS) resolve(name string) (string, error) {
+	root, err := f.realRoot()
+	if err != nil {
+		return "", err
+	}
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("fs: absolute paths are not allowed: %v", name)
+	}
+	full := filepath.Join(root, filepath.FromSlash(name))
+
+	// the target might not exist yet (eg.: write/mkdir), so links
+	// are followed by hand instead of using filepath.EvalSymlinks,
+	// which gives up on links pointing to missing files
+	real, err := realPath(full)
+	if err != nil {
+		return "", err
+	}
+	if f.isProtected(real) {
+		return "", errFSProtect
+	}
+	if !within(root, real) {
+		return f.escape(full)
+	}
+	if err := f.allow(CapFS, full); err != nil {
+		return "", err
+	}
+	return full, nil
+}
+
+func (f *sandboxFS) isProtected(real string) bool {
+	if f.protected == nil {
+		return false
+	}
+	for _, dir := range f.protected() {
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			return true
+		}
+		dir, err = realPath(dir)
+		if err != nil || within(dir, real) {
+			return true
+		}
+	}
+	return false
+}
+
+// escape checks if a path outside the sandbox root was explicitly granted
+func (f *sandboxFS) escape(full string) (string, error) {
+	if err := f.request(CapFS, full); err != nil {
+		return "", errFSEscape
+	}
+	return full, nil
+}
+
+// realPath follows every symlink in path, one component at a time.
+// Once a component does not exist the remaining ones are kept as is
+func realPath(path string) (string, error) {
+	const maxLinks = 255
+	sep := string(filepath.Separator)
+	vol := filepath.VolumeName(path)
+	dest := vol + sep
+	rest := strings.TrimPrefix(path[len(vol):], sep)
+	links := 0
+	for rest != "" {
+		var comp string
+		comp, rest, _ = strings.Cut(rest, sep)
+		switch comp {
+		case "", ".":
+			continue
+		case "..":
+			dest = filepath.Dir(dest)
+			continue
+		}
+		next := filepath.Join(dest, comp)
+		info, err := os.Lstat(next)
+		if errors.Is(err, fs.ErrNotExist) {
+			return filepath.Join(next, rest), nil
+		} else if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			dest = next
+			continue
+		}
+		links++
+		if links > maxLinks {
+			return "", fmt.Errorf("fs: too many links: %v", path)
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			vol = filepath.VolumeName(target)
+			dest = vol + sep
+			target = strings.TrimPrefix(target[len(vol):], sep)
+		}
+		if rest != "" {
+			target += sep + rest
+		}
+		rest = target
+	}
+	return dest, nil
+}
+
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (f *sandboxFS) pathArg(args []tengo.Object, idx int, name string) (string, error) {
+	if len(args) <= idx {
+		return "", tengo.ErrWrongNumArguments
+	}
+	p, ok := tengo.ToString(args[idx])
+	if !ok {
+		return "", tengo.ErrInvalidArgumentType{
+			Name:     name,
+			Expected: "string",
+			Found:    args[idx].TypeName(),
+		}
+	}
+	return f.resolve(p)
+}
+
+func (f *sandboxFS) read(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	p, err := f.pathArg(args, 0, "path")
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	buf, err := os.ReadFile(p)
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	if len(buf) > tengo.MaxStringLen {
+		return tengo.UndefinedValue, tengo.ErrStringLimit
+	}
+	return &tengo.String{Value: string(buf)}, nil
+}
+
+func (f *sandboxFS) write(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 2 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	if f.readOnly {
+		return tengo.UndefinedValue, errFSReadOnly
+	}
+	p, err := f.pathArg(args, 0, "path")
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	content, ok := tengo.ToByteSlice(args[1])
+	if !ok {
+		return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+			Name:     "content",
+			Expected: "string|bytes",
+			Found:    args[1].TypeName(),
+		}
+	}
+	return tengo.UndefinedValue, os.WriteFile(p, content, 0644)
+}
+
+func (f *sandboxFS) list(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) > 1 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	if len(args) == 0 {
+		args = []tengo.Object{&tengo.String{Value: "."}}
+	}
+	p, err := f.pathArg(args, 0, "dir")
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	out := &tengo.Array{}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out.Value = append(out.Value, fileInfoMap(info))
+	}
+	return out, nil
+}
+
+func (f *sandboxFS) stat(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	p, err := f.pathArg(args, 0, "path")
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	return fileInfoMap(info), nil
+}
+
+func (f *sandboxFS) glob(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	pattern, ok := tengo.ToString(args[0])
+	if !ok {
+		return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+			Name:     "pattern",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+	}
+	root, err := f.realRoot()
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	if filepath.IsAbs(pattern) {
+		return tengo.UndefinedValue, fmt.Errorf("fs: absolute paths are not allowed: %v", pattern)
+	}
+	// permission is asked once, for the directory the pattern
+	// starts from, instead of once for every match
+	base, err := f.resolve(globBase(pattern))
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	realBase, err := realPath(base)
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	matches, err := filepath.Glob(filepath.Join(root, filepath.FromSlash(pattern)))
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	out := &tengo.Array{Value: []tengo.Object{}}
+	for _, m := range matches {
+		rel, err := filepath.Rel(root, m)
+		if err != nil {
+			continue
+		}
+		// silently drop links leading out of the sandbox
+		real, err := realPath(m)
+		if err != nil || f.isProtected(real) || !within(root, real) && !within(realBase, real) {
+			continue
+		}
+		out.Value = append(out.Value, &tengo.String{Value: filepath.ToSlash(rel)})
+	}
+	return out, nil
+}
+
+// globBase returns the leading directories of pattern
+// which do not contain any special characters
+func globBase(pattern string) string {
+	var base []string
+	for _, dir := range strings.Split(filepath.ToSlash(pattern), "/") {
+		if strings.ContainsAny(dir, `*?[\`) {
+			break
+		}
+		base = append(base, dir)
+	}
+	return path.Join(base...)
+}
+
+func (f *sandboxFS) mkdir(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	if f.readOnly {
+		return tengo.UndefinedValue, errFSReadOnly
+	}
+	p, err := f.pathArg(args, 0, "path")
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	return tengo.UndefinedValue, os.MkdirAll(p, 0755)
+}
+
+func (f *sandboxFS) remove(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	if f.readOnly {
+		return tengo.UndefinedValue, errFSReadOnly
+	}
+	p, err := f.pathArg(args, 0, "path")
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	root, err := f.realRoot()
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	if p == root {
+		return tengo.UndefinedValue, errors.New("fs: cannot remove the sandbox root")
+	}
+	if len(args) == 2 && !args[1].IsFalsy() {
+		return tengo.UndefinedValue, os.RemoveAll(p)
+	}
+	return tengo.UndefinedValue, os.Remove(p)
+}
+
+func fileInfoMap(info fs.FileInfo) *tengo.Map {
+	isDir := tengo.FalseValue
+	if info.IsDir() {
+		isDir = tengo.TrueValue
+	}
+	return &tengo.Map{Value: map[string]tengo.Object{
+		"name":     &tengo.String{Value: info.Name()},
+		"size":     &tengo.Int{Value: info.Size()},
+		"mode":     &tengo.String{Value: info.Mode().String()},
+		"is_dir":   isDir,
+		"mod_time": &tengo.Time{Value: info.ModTime()},
+	}}
+}
@@ -0,0 +1,210 @@
+package shell
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/d5/tengo/v2"
+)
+
+func newTestSandbox(t *testing.T) (*sandboxFS, string, string) {
+	t.Helper()
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+	for _, d := range []string{root, outside, filepath.Join(root, "sub"), filepath.Join(root, ".appshell")} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := &sandboxFS{
+		root:      func() string { return root },
+		protected: func() []string { return []string{filepath.Join(root, ".appshell")} },
+		allow:     func(Capability, string) error { return nil },
+		request:   func(Capability, string) error { return errors.New("denied") },
+	}
+	return f, root, outside
+}
+
+func TestSandboxResolve(t *testing.T) {
+	f, root, outside := newTestSandbox(t)
+	links := map[string]string{
+		"inside":        "sub",
+		"escape":        outside,
+		"dangling":      filepath.Join(outside, "missing.txt"),
+		"dangling-dir":  filepath.Join(outside, "missing", "dir"),
+		"relative":      filepath.Join("..", "outside"),
+		"sub/up":        "..",
+		"sub/chain":     filepath.Join("..", "dangling"),
+		"sub/intoroot":  filepath.Join("..", "sub", "file.txt"),
+		"missing-local": "not-there-yet.txt",
+		"control":       ".appshell",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Skipf("symlinks are not supported: %v", err)
+		}
+	}
+	tests := []struct {
+		path    string
+		escape  bool
+		protect bool
+	}{
+		{"file.txt", false, false},
+		{"sub/file.txt", false, false},
+		{"missing/dir/file.txt", false, false},
+		{"inside/file.txt", false, false},
+		{"sub/up/file.txt", false, false},
+		{"sub/intoroot", false, false},
+		{"missing-local", false, false},
+		{"../outside/file.txt", true, false},
+		{"sub/../../outside", true, false},
+		{"escape", true, false},
+		{"escape/file.txt", true, false},
+		{"escape/missing/file.txt", true, false},
+		{"dangling", true, false},
+		{"dangling-dir/file.txt", true, false},
+		{"relative/file.txt", true, false},
+		{"sub/chain", true, false},
+		{"sub/up/escape/file.txt", true, false},
+		{".appshell", false, true},
+		{".appshell/permissions.json", false, true},
+		{"sub/../.appshell/jobs.json", false, true},
+		{"control/permissions.json", false, true},
+		{"sub/up/control", false, true},
+		{".appshellx/file.txt", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			_, err := f.resolve(tt.path)
+			switch {
+			case tt.protect && !errors.Is(err, errFSProtect):
+				t.Fatalf("expected %v, got %v", errFSProtect, err)
+			case tt.protect:
+			case tt.escape && !errors.Is(err, errFSEscape):
+				t.Fatalf("expected %v, got %v", errFSEscape, err)
+			case !tt.escape && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+	if _, err := f.resolve(filepath.Join(outside, "file.txt")); err == nil {
+		t.Fatal("absolute paths must be rejected")
+	}
+}
+
+func TestSandboxWriteDanglingLink(t *testing.T) {
+	f, root, outside := newTestSandbox(t)
+	target := filepath.Join(outside, "written.txt")
+	if err := os.Symlink(target, filepath.Join(root, "link")); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+	_, err := f.write(stringArgs("link", "x")...)
+	if !errors.Is(err, errFSEscape) {
+		t.Fatalf("expected %v, got %v", errFSEscape, err)
+	}
+	if _, err := os.Stat(target); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("file outside the sandbox was written: %v", err)
+	}
+}
+
+func TestProtectDir(t *testing.T) {
+	s := newTestShell(t)
+	s.EnableFileSystem("", false)
+	s.EnableExec()
+	control := filepath.Join(s.importsDir, ".appshell")
+	s.ProtectDir(control)
+	// like the GUI: the whole workspace is granted
+	s.SetPolicy(&Policy{Modules: []string{"*"}, Executables: []string{"*"}, FSRoots: []string{s.importsDir}})
+	tests := []string{
+		`fs.write(".appshell/permissions.json", "{}")`,
+		`fs.read(".appshell/jobs.json")`,
+		`fs.list(".appshell")`,
+		`fs.mkdir(".appshell/snapshots")`,
+		`exec.run("ls", {dir: ".appshell"})`,
+	}
+	if _, err := eval(t, s, `fs := import("fs"); exec := import("exec")`); err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range tests {
+		t.Run(code, func(t *testing.T) {
+			_, err := eval(t, s, code)
+			if err == nil || !strings.Contains(err.Error(), errFSProtect.Error()) {
+				t.Fatalf("expected %v, got %v", errFSProtect, err)
+			}
+		})
+	}
+	if _, err := os.Stat(filepath.Join(control, "permissions.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("protected file was written: %v", err)
+	}
+}
+
+func TestSandboxGlob(t *testing.T) {
+	f, root, outside := newTestSandbox(t)
+	for _, name := range []string{
+		filepath.Join(root, "a.txt"),
+		filepath.Join(root, "b.txt"),
+		filepath.Join(root, "sub", "c.txt"),
+		filepath.Join(root, ".appshell", "jobs.json"),
+		filepath.Join(outside, "x.txt"),
+		filepath.Join(outside, "y.txt"),
+	} {
+		if err := os.WriteFile(name, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "sub", "escape")); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+	tests := []struct {
+		pattern string
+		grant   bool
+		want    string
+		asked   int
+		fail    bool
+	}{
+		{pattern: "*.txt", want: "a.txt,b.txt"},
+		{pattern: "sub/*", want: "sub/c.txt"},
+		{pattern: "*/*.json", want: ""},
+		{pattern: "sub/escape/*", fail: true, asked: 1},
+		{pattern: "../outside/*", fail: true, asked: 1},
+		{pattern: "../outside/*", grant: true, want: "../outside/x.txt,../outside/y.txt", asked: 1},
+		{pattern: "../*/*.txt", grant: true, want: "../outside/x.txt,../outside/y.txt,a.txt,b.txt", asked: 1},
+		{pattern: "[", fail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			asked := 0
+			f.request = func(Capability, string) error {
+				asked++
+				if tt.grant {
+					return nil
+				}
+				return errors.New("denied")
+			}
+			out, err := f.glob(stringArgs(tt.pattern)...)
+			if asked != tt.asked {
+				t.Errorf("expected %v permission requests, got %v", tt.asked, asked)
+			}
+			if tt.fail {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, v := range out.(*tengo.Array).Value {
+				got = append(got, v.(*tengo.String).Value)
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/d5/tengo/v2"
+)
+
+const (
+	// same limit used by http.DefaultClient
+	maxRedirects = 10
+)
+
+var (
+	errTooManyRedirects = errors.New("http: stopped after 10 redirects")
+)
+
+// SetHTTPClient configures the client used by both jsonrpc and http modules,
+// by default a client like http.DefaultClient is used
+func (s *Shell) SetHTTPClient(c *http.Client) {
+	s.client = c
+}
+
+// httpClient returns a copy of the configured client which checks every
+// redirect against the policy, otherwise a server could send scripts to
+// hosts they are not allowed to reach
+func (s *Shell) httpClient() *http.Client {
+	var c http.Client
+	if s.client != nil {
+		c = *s.client
+	}
+	next := c.CheckRedirect
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := s.allowURL(CapRPC, req.URL.String()); err != nil {
+			return err
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		if len(via) >= maxRedirects {
+			return errTooManyRedirects
+		}
+		return nil
+	}
+	return &c
+}
+
+// EnableHTTPClient exposes the http module to scripts, requests are
+// subject to the same host allow-list used by jsonrpc
+func (s *Shell) EnableHTTPClient() {
+	method := func(name, method string) *tengo.UserFunction {
+		return &tengo.UserFunction{
+			Name: name,
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				return s.httpDo(method, args...)
+			},
+		}
+	}
+	s.httpMod = map[string]tengo.Object{
+		"get":    method("get", "GET"),
+		"post":   method("post", "POST"),
+		"put":    method("put", "PUT"),
+		"delete": method("delete", "DELETE"),
+		"request": &tengo.UserFunction{
+			Name: "request",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) == 0 {
+					return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+				}
+				method, ok := tengo.ToString(args[0])
+				if !ok {
+					return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+						Name:     "method",
+						Expected: "string",
+						Found:    args[0].TypeName(),
+					}
+				}
+				return s.httpDo(strings.ToUpper(method), args[1:]...)
+			},
+		},
+	}
+}
+
+// httpDo implements the http module functions: (url, [opts]), opts might contain:
+// headers (map), query (map), json (any), form (map), body (string|bytes)
+// and timeout (duration)
+func (s *Shell) httpDo(method string, args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	rawURL, ok := tengo.ToString(args[0])
+	if !ok {
+		return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+			Name:     "url",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+	}
+	opts := map[string]tengo.Object{}
+	if len(args) == 2 {
+		m, ok := args[1].(*tengo.Map)
+		if !ok {
+			return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+				Name:     "opts",
+				Expected: "map",
+				Found:    args[1].TypeName(),
+			}
+		}
+		opts = m.Value
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	if err := s.allowURL(CapRPC, rawURL); err != nil {
+		return tengo.UndefinedValue, err
+	}
+	if v, found := opts["query"]; found {
+		query, ok := tengo.ToInterface(v).(map[string]any)
+		if !ok {
+			return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+				Name:     "query",
+				Expected: "map",
+				Found:    v.TypeName(),
+			}
+		}
+		q := u.Query()
+		for k, v := range query {
+			if arr, ok := v.([]any); ok {
+				for _, item := range arr {
+					q.Add(k, fmt.Sprint(item))
+				}
+				continue
+			}
+			q.Set(k, fmt.Sprint(v))
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	var body io.Reader
+	var contentType string
+	if v, found := opts["json"]; found {
+		buf, err := json.Marshal(tengo.ToInterface(v))
+		if err != nil {
+			return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+				Name:     "json",
+				Expected: "any (json serializable)",
+				Found:    v.TypeName(),
+			}
+		}
+		body, contentType = bytes.NewReader(buf), "application/json"
+	} else if v, found := opts["form"]; found {
+		form, ok := tengo.ToInterface(v).(map[string]any)
+		if !ok {
+			return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+				Name:     "form",
+				Expected: "map",
+				Found:    v.TypeName(),
+			}
+		}
+		values := url.Values{}
+		for k, v := range form {
+			values.Set(k, fmt.Sprint(v))
+		}
+		body, contentType = strings.NewReader(values.Encode()), "application/x-www-form-urlencoded"
+	} else if v, found := opts["body"]; found {
+		buf, ok := tengo.ToByteSlice(v)
+		if !ok {
+			return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+				Name:     "body",
+				Expected: "string|bytes",
+				Found:    v.TypeName(),
+			}
+		}
+		body = bytes.NewReader(buf)
+	}
+
+	ctx := s.ctx
+	if v, found := opts["timeout"]; found {
+		timeout, ok := toDuration(v)
+		if !ok {
+			return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+				Name:     "timeout",
+				Expected: "duration (int milliseconds or string)",
+				Found:    v.TypeName(),
+			}
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if v, found := opts["headers"]; found {
+		headers, ok := v.(*tengo.Map)
+		if !ok {
+			return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+				Name:     "headers",
+				Expected: "map",
+				Found:    v.TypeName(),
+			}
+		}
+		for k, v := range headers.Value {
+			req.Header.Set(k, secretValue(v))
+		}
+	}
+
+	res, err := s.httpClient().Do(req)
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	defer res.Body.Close()
+	buf, err := io.ReadAll(io.LimitReader(res.Body, int64(tengo.MaxStringLen)+1))
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	if len(buf) > tengo.MaxStringLen {
+		return tengo.UndefinedValue, tengo.ErrStringLimit
+	}
+	return httpResponse(res, buf)
+}
+
+func httpResponse(res *http.Response, body []byte) (tengo.Object, error) {
+	headers := map[string]tengo.Object{}
+	for k, v := range res.Header {
+		headers[k] = &tengo.String{Value: strings.Join(v, ", ")}
+	}
+	out := map[string]tengo.Object{
+		"status":      &tengo.Int{Value: int64(res.StatusCode)},
+		"status_text": &tengo.String{Value: http.StatusText(res.StatusCode)},
+		"headers":     &tengo.Map{Value: headers},
+		"body":        &tengo.String{Value: string(body)},
+	}
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		var v any
+		if err := json.Unmarshal(body, &v); err == nil {
+			obj, err := tengo.FromInterface(v)
+			if err != nil {
+				return tengo.UndefinedValue, err
+			}
+			out["json"] = obj
+		}
+	}
+	return &tengo.Map{Value: out}, nil
+}
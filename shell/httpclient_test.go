@@ -0,0 +1,59 @@
+package shell
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHTTPRedirectPolicy(t *testing.T) {
+	var reached atomic.Int32
+	forbidden := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":"1","result":"secret"}`))
+	}))
+	defer forbidden.Close()
+	allowed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/local" {
+			w.Write([]byte(`ok`))
+			return
+		}
+		http.Redirect(w, r, forbidden.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer allowed.Close()
+
+	tests := []struct {
+		name string
+		code string
+		fail bool
+	}{
+		{"same host", `http.get("` + allowed.URL + `/local")`, false},
+		{"http get", `http.get("` + allowed.URL + `/")`, true},
+		{"http post", `http.post("` + allowed.URL + `/", {body: "x"})`, true},
+		{"jsonrpc", `jsonrpc.call("` + allowed.URL + `/rpc", "echo", {})`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached.Store(0)
+			s := newTestShell(t)
+			s.EnableHTTPClient()
+			s.EnableJSONRPCClient()
+			s.SetPolicy(&Policy{
+				Modules:  []string{"*"},
+				RPCHosts: []string{strings.TrimPrefix(allowed.URL, "http://")},
+			})
+			_, err := eval(t, s, `http := import("http"); jsonrpc := import("jsonrpc"); `+tt.code)
+			if tt.fail && err == nil {
+				t.Fatal("expected an error")
+			} else if !tt.fail && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if reached.Load() != 0 {
+				t.Fatal("redirect reached a host outside the policy")
+			}
+		})
+	}
+}
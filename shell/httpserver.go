@@ -0,0 +1,208 @@
+package shell
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/d5/tengo/v2"
+)
+
+// EnableHTTPServer exposes the httpserver module, which allows scripts
+// to handle http requests. Handlers run inside the session, so requests
+// wait for any running evaluation to finish.
+//
+// Servers are stopped when the session is reset or the shell is closed.
+func (s *Shell) EnableHTTPServer() {
+	s.httpserverMod = map[string]tengo.Object{
+		"listen": &tengo.UserFunction{Name: "listen", Value: s.httpListen},
+	}
+}
+
+// httpListen implements httpserver.listen(addr, routes), routes maps
+// patterns (as accepted by http.ServeMux) to handler functions
+func (s *Shell) httpListen(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 2 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	addr, ok := tengo.ToString(args[0])
+	if !ok {
+		return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+			Name:     "addr",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+	}
+	routes, ok := args[1].(*tengo.Map)
+	if !ok {
+		return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+			Name:     "routes",
+			Expected: "map",
+			Found:    args[1].TypeName(),
+		}
+	}
+	if err := s.allow(CapListen, addr); err != nil {
+		return tengo.UndefinedValue, err
+	}
+
+	mux := http.NewServeMux()
+	patterns := make([]string, 0, len(routes.Value))
+	for pattern := range routes.Value {
+		patterns = append(patterns, pattern)
+	}
+	// sorted, so conflicts are always reported for the same route
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		fn := routes.Value[pattern]
+		if !fn.CanCall() {
+			return tengo.UndefinedValue, fmt.Errorf("httpserver: handler for %q is not callable", pattern)
+		}
+		if err := handleRoute(mux, pattern, s.scriptHandler(fn)); err != nil {
+			return tengo.UndefinedValue, err
+		}
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	srv := &http.Server{Handler: mux}
+	untrack := s.resources.track(srv)
+	go func() {
+		defer untrack()
+		err := srv.Serve(l)
+		if !errors.Is(err, http.ErrServerClosed) {
+			s.background(context.Background(), func() error {
+				fmt.Fprintf(&s.stderr, "httpserver: %v stopped: %v\n", l.Addr(), err)
+				return nil
+			})
+		}
+	}()
+
+	return &tengo.ImmutableMap{Value: map[string]tengo.Object{
+		"addr": &tengo.String{Value: l.Addr().String()},
+		"stop": &tengo.UserFunction{
+			Name: "stop",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				return tengo.UndefinedValue, srv.Close()
+			},
+		},
+	}}, nil
+}
+
+// handleRoute adds pattern to mux, which panics when the pattern is
+// invalid or conflicts with one added before
+func handleRoute(mux *http.ServeMux, pattern string, h http.Handler) (err error) {
+	if strings.TrimSpace(pattern) == "" {
+		return errors.New("httpserver: routes cannot be empty")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("httpserver: route %q: %v", pattern, r)
+		}
+	}()
+	mux.Handle(pattern, h)
+	return nil
+}
+
+func (s *Shell) scriptHandler(fn tengo.Object) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, int64(tengo.MaxStringLen)))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var res tengo.Object
+		err = s.background(r.Context(), func() error {
+			fmt.Fprintf(&s.stdout, "httpserver: %v %v from %v\n", r.Method, r.URL, r.RemoteAddr)
+			res, err = s.call(fn, httpRequestMap(r, body))
+			if err != nil {
+				fmt.Fprintf(&s.stderr, "httpserver: %v %v failed: %v\n", r.Method, r.URL, err)
+			}
+			return err
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeHTTPResponse(w, res)
+	})
+}
+
+func httpRequestMap(r *http.Request, body []byte) tengo.Object {
+	headers := map[string]tengo.Object{}
+	for k, v := range r.Header {
+		headers[k] = &tengo.String{Value: strings.Join(v, ", ")}
+	}
+	query := map[string]tengo.Object{}
+	for k, v := range r.URL.Query() {
+		query[k] = &tengo.String{Value: strings.Join(v, ",")}
+	}
+	req := map[string]tengo.Object{
+		"method":  &tengo.String{Value: r.Method},
+		"path":    &tengo.String{Value: r.URL.Path},
+		"query":   &tengo.Map{Value: query},
+		"headers": &tengo.Map{Value: headers},
+		"body":    &tengo.String{Value: string(body)},
+		"remote":  &tengo.String{Value: r.RemoteAddr},
+	}
+	var v any
+	if json.Unmarshal(body, &v) == nil {
+		if obj, err := tengo.FromInterface(v); err == nil {
+			req["json"] = obj
+		}
+	}
+	return &tengo.Map{Value: req}
+}
+
+// writeHTTPResponse accepts a map with status, headers, body or json,
+// any other value is written as the response body
+func writeHTTPResponse(w http.ResponseWriter, res tengo.Object) {
+	var m map[string]tengo.Object
+	switch res := res.(type) {
+	case *tengo.Map:
+		m = res.Value
+	case *tengo.ImmutableMap:
+		m = res.Value
+	case *tengo.Undefined:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		str, _ := tengo.ToString(res)
+		io.WriteString(w, str)
+		return
+	}
+
+	if headers, ok := m["headers"].(*tengo.Map); ok {
+		for k, v := range headers.Value {
+			str, _ := tengo.ToString(v)
+			w.Header().Set(k, str)
+		}
+	}
+	var body []byte
+	if v, found := m["json"]; found {
+		buf, err := json.Marshal(tengo.ToInterface(v))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		body = buf
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+	} else if v, found := m["body"]; found {
+		body, _ = tengo.ToByteSlice(v)
+	}
+	status := http.StatusOK
+	if v, ok := m["status"].(*tengo.Int); ok {
+		status = int(v.Value)
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,118 @@
+package shell
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// listen starts a server with routes and returns its address
+func listen(t *testing.T, s *Shell, routes string) string {
+	t.Helper()
+	out, err := eval(t, s, `httpserver := import("httpserver")
+srv := httpserver.listen("127.0.0.1:0", `+routes+`)
+srv.addr`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "http://" + lastLine(out)
+}
+
+func TestHTTPServer(t *testing.T) {
+	s := newTestShell(t)
+	s.EnableHTTPServer()
+	base := listen(t, s, `{
+	"GET /hello": func(req) { return "hello " + req.query.name },
+	"POST /echo": func(req) { return {status: 201, headers: {"X-Method": req.method}, json: {got: req.json.n + 1}} },
+	"/empty": func(req) {},
+	"/fail": func(req) { return req.missing() }
+}`)
+	tests := []struct {
+		method, path, body string
+		status             int
+		want               string
+		header             string
+	}{
+		{"GET", "/hello?name=ann", "", 200, "hello ann", ""},
+		{"POST", "/hello", "", 405, "", ""},
+		{"POST", "/echo", `{"n": 1}`, 201, `{"got":2}`, "POST"},
+		{"GET", "/empty", "", 204, "", ""},
+		{"GET", "/fail", "", 500, "", ""},
+		{"GET", "/missing", "", 404, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, base+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			body, _ := io.ReadAll(res.Body)
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %v, got %v: %s", tt.status, res.StatusCode, body)
+			}
+			if tt.want != "" && string(body) != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, body)
+			}
+			if got := res.Header.Get("X-Method"); got != tt.header {
+				t.Fatalf("expected header %q, got %q", tt.header, got)
+			}
+		})
+	}
+}
+
+func TestHTTPServerRoutes(t *testing.T) {
+	listen := func(routes string) string {
+		return `httpserver.listen("127.0.0.1:0", ` + routes + `).stop()`
+	}
+	runScripts(t, (*Shell).EnableHTTPServer, `httpserver := import("httpserver")`, []scriptTest{
+		{"valid", listen(`{"GET /items/{id}": func(req) {}, "/": func(req) {}}`) + `; "ok"`, "ok", false},
+		{"empty", listen(`{"": func(req) {}}`), "", true},
+		{"blank", listen(`{" ": func(req) {}}`), "", true},
+		{"method only", listen(`{"GET": func(req) {}}`), "", true},
+		{"malformed", listen(`{"/{id": func(req) {}}`), "", true},
+		{"conflict", listen(`{"/a/{x}": func(req) {}, "/a/{y}": func(req) {}}`), "", true},
+		{"not callable", listen(`{"/": 1}`), "", true},
+		{"not a map", listen(`["/"]`), "", true},
+		{"bad address", `httpserver.listen("127.0.0.1:-1", {})`, "", true},
+	})
+}
+
+func TestHTTPServerStopped(t *testing.T) {
+	tests := []struct {
+		name string
+		stop func(s *Shell) error
+	}{
+		{"stop", func(s *Shell) error {
+			_, err := eval(t, s, `srv.stop()`)
+			return err
+		}},
+		{"reset", func(s *Shell) error { return s.Reset(context.Background()) }},
+		{"close", func(s *Shell) error { return s.Close() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestShell(t)
+			s.EnableHTTPServer()
+			base := listen(t, s, `{"/": func(req) { return "up" }}`)
+			res, err := http.Get(base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if err := tt.stop(s); err != nil {
+				t.Fatal(err)
+			}
+			if res, err := http.Get(base); err == nil {
+				res.Body.Close()
+				t.Fatal("the server is still running")
+			}
+		})
+	}
+}
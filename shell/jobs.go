@@ -0,0 +1,555 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/d5/tengo/v2"
+	"github.com/d5/tengo/v2/parser"
+	"github.com/robfig/cron/v3"
+)
+
+type (
+	// JobInfo describes a job registered with jobs.add
+	JobInfo struct {
+		Name    string    `json:"name"`
+		Spec    string    `json:"spec"`
+		Source  string    `json:"source"`
+		Created time.Time `json:"created"`
+		Next    time.Time `json:"-"`
+		Running bool      `json:"-"`
+		Runs    []JobRun  `json:"-"`
+	}
+
+	// JobRun is the outcome of one execution of a job
+	JobRun struct {
+		Start    time.Time     `json:"start"`
+		Duration time.Duration `json:"duration"`
+		Result   string        `json:"result,omitempty"`
+		Error    string        `json:"error,omitempty"`
+		Output   string        `json:"output,omitempty"`
+	}
+
+	// jobScheduler runs the persisted jobs, each run happens in a new
+	// session configured like the shell which owns the scheduler
+	jobScheduler struct {
+		mu      sync.Mutex
+		loaded  bool
+		jobs    map[string]*scheduledJob
+		history map[string][]JobRun
+		wake    chan struct{}
+	}
+
+	scheduledJob struct {
+		JobInfo
+		schedule cron.Schedule
+	}
+
+	jobsFile struct {
+		Jobs    []JobInfo           `json:"jobs"`
+		History map[string][]JobRun `json:"history"`
+	}
+
+	// cappedBuffer keeps only the first max bytes written to it
+	cappedBuffer struct {
+		mu  sync.Mutex
+		buf bytes.Buffer
+		max int
+	}
+)
+
+const (
+	jobsFileName     = "jobs.json"
+	maxJobRuns       = 20
+	maxJobOutput     = 64 * 1024
+	jobResultVarName = "__job_result__"
+)
+
+var (
+	errNoDataDir = errors.New("data directory is not configured")
+	errNoSuchJob = errors.New("jobs: job not found")
+	errJobBusy   = errors.New("jobs: job is already running")
+)
+
+// EnableJobs exposes the jobs module to scripts, jobs are saved
+// in the directory configured by SetDataDir.
+//
+// Jobs run unattended, so they are limited to what the Policy grants:
+// permissions given to the interactive session, either by Grant or by
+// answering the prompt, do not apply to them
+func (s *Shell) EnableJobs() {
+	s.jobsMod = map[string]tengo.Object{
+		"add":     &tengo.UserFunction{Name: "add", Value: s.jobsAdd},
+		"remove":  &tengo.UserFunction{Name: "remove", Value: s.jobsRemove},
+		"list":    &tengo.UserFunction{Name: "list", Value: s.jobsList},
+		"history": &tengo.UserFunction{Name: "history", Value: s.jobsHistory},
+		"run":     &tengo.UserFunction{Name: "run", Value: s.jobsRun},
+	}
+}
+
+// StartJobs loads the persisted jobs and runs them on schedule
+// until ctx is done
+func (s *Shell) StartJobs(ctx context.Context) error {
+	if err := s.jobs.load(s.dataDir); err != nil {
+		return err
+	}
+	go s.jobs.loop(ctx, s)
+	return nil
+}
+
+// Jobs returns the registered jobs and their recent runs
+func (s *Shell) Jobs() []JobInfo {
+	if err := s.jobs.load(s.dataDir); err != nil {
+		return nil
+	}
+	return s.jobs.list()
+}
+
+// RunJob executes the job immediately, without waiting for its schedule
+func (s *Shell) RunJob(ctx context.Context, name string) (JobRun, error) {
+	if err := s.jobs.load(s.dataDir); err != nil {
+		return JobRun{}, err
+	}
+	j, err := s.jobs.start(name)
+	if err != nil {
+		return JobRun{}, err
+	}
+	return s.runJob(ctx, j), nil
+}
+
+// jobsAdd implements add(name, spec, source), spec is a standard cron
+// expression (or a descriptor like @hourly) and source is either a
+// script or a function literal whose result is recorded
+func (s *Shell) jobsAdd(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 3 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	var strs [3]string
+	for i, name := range []string{"name", "spec", "source"} {
+		v, ok := args[i].(*tengo.String)
+		if !ok {
+			return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+				Name:     name,
+				Expected: "string",
+				Found:    args[i].TypeName(),
+			}
+		}
+		strs[i] = v.Value
+	}
+	if _, err := s.Parse(s.ctx, strs[2]); err != nil {
+		return tengo.UndefinedValue, fmt.Errorf("jobs: invalid source: %w", err)
+	}
+	j, err := newScheduledJob(JobInfo{Name: strs[0], Spec: strs[1], Source: strs[2], Created: time.Now()})
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	if err := s.jobs.load(s.dataDir); err != nil {
+		return tengo.UndefinedValue, err
+	}
+	if err := s.jobs.add(s.dataDir, j); err != nil {
+		return tengo.UndefinedValue, err
+	}
+	return &tengo.Time{Value: j.Next}, nil
+}
+
+func (s *Shell) jobsRemove(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	name, ok := tengo.ToString(args[0])
+	if !ok {
+		return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+			Name:     "name",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+	}
+	if err := s.jobs.load(s.dataDir); err != nil {
+		return tengo.UndefinedValue, err
+	}
+	removed, err := s.jobs.remove(s.dataDir, name)
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	return boolObject(removed), nil
+}
+
+func (s *Shell) jobsList(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 0 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	if err := s.jobs.load(s.dataDir); err != nil {
+		return tengo.UndefinedValue, err
+	}
+	out := &tengo.Array{Value: []tengo.Object{}}
+	for _, j := range s.jobs.list() {
+		m := map[string]tengo.Object{
+			"name":    &tengo.String{Value: j.Name},
+			"spec":    &tengo.String{Value: j.Spec},
+			"source":  &tengo.String{Value: j.Source},
+			"next":    &tengo.Time{Value: j.Next},
+			"running": boolObject(j.Running),
+			"runs":    &tengo.Int{Value: int64(len(j.Runs))},
+		}
+		if len(j.Runs) > 0 {
+			m["last"] = j.Runs[len(j.Runs)-1].object()
+		}
+		out.Value = append(out.Value, &tengo.ImmutableMap{Value: m})
+	}
+	return out, nil
+}
+
+func (s *Shell) jobsHistory(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	name, _ := tengo.ToString(args[0])
+	if err := s.jobs.load(s.dataDir); err != nil {
+		return tengo.UndefinedValue, err
+	}
+	out := &tengo.Array{Value: []tengo.Object{}}
+	for _, r := range s.jobs.runs(name) {
+		out.Value = append(out.Value, r.object())
+	}
+	return out, nil
+}
+
+// jobsRun runs a job right away and returns the outcome, the current
+// session is not affected since the job runs in its own session
+func (s *Shell) jobsRun(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	name, _ := tengo.ToString(args[0])
+	run, err := s.RunJob(s.ctx, name)
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	return run.object(), nil
+}
+
+// runJob executes j in an isolated session, records the run and
+// logs its outcome. j must have been marked as running by start
+func (s *Shell) runJob(ctx context.Context, j JobInfo) JobRun {
+	out := &cappedBuffer{max: maxJobOutput}
+	run := JobRun{Start: time.Now()}
+	session := s.isolated()
+	defer session.Close()
+	result, err := session.runSource(ctx, out, j.Source)
+	run.Duration = time.Since(run.Start)
+	run.Output = s.Redact(out.String())
+	if err != nil {
+		run.Error = s.Redact(err.Error())
+	} else if result != nil && result != tengo.UndefinedValue {
+		str, _ := tengo.ToString(result)
+		run.Result = s.Redact(str)
+	}
+	if err := s.jobs.finish(s.dataDir, j.Name, run); err != nil {
+		s.logger().Error("jobs: saving history failed", "job", j.Name, "error", err)
+	}
+	level := slog.LevelInfo
+	if run.Error != "" {
+		level = slog.LevelError
+	}
+	s.logger().Log(context.Background(), level, "job finished",
+		"job", j.Name, "duration", run.Duration, "result", run.Result, "error", run.Error)
+	return run
+}
+
+// runSource evaluates a job source, function literals are called
+// and their return value becomes the result of the job
+func (s *Shell) runSource(ctx context.Context, out io.Writer, source string) (tengo.Object, error) {
+	_, file, err := s.parseAST(parser.NewFileSet(), source)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Stmts) == 1 {
+		if stmt, ok := file.Stmts[0].(*parser.ExprStmt); ok {
+			if _, ok := stmt.Expr.(*parser.FuncLit); ok {
+				source = fmt.Sprintf("%v := (%v)()", jobResultVarName, source)
+			}
+		}
+	}
+	if err := s.eval(ctx, out, out, source, nil, false); err != nil {
+		return nil, err
+	}
+	s.session.Lock()
+	defer s.session.Unlock()
+	return s.replGlobals()[jobResultVarName], nil
+}
+
+// isolated returns a new shell with the same modules, policy and
+// settings but none of the state. It never prompts for permissions
+// and session grants are not copied, see EnableJobs
+func (s *Shell) isolated() *Shell {
+	c := New()
+	c.importsDir = s.importsDir
+	c.protected = s.protected
+	c.snapshots = s.snapshots
+	c.policy = s.policy
+	c.client = s.client
+	c.logHandler = s.logHandler
+	c.vault = s.vault
+	s.redaction.mu.Lock()
+	c.SetRedaction(s.redaction.rules)
+	s.redaction.mu.Unlock()
+	c.OnAudit(s.recordAudit)
+	if s.jsonrpcMod != nil {
+		c.EnableJSONRPCClient()
+	}
+	if s.fs != nil {
+		c.EnableFileSystem(s.fs.root(), s.fs.readOnly)
+	}
+	if s.execMod != nil {
+		c.EnableExec()
+	}
+	if s.httpMod != nil {
+		c.EnableHTTPClient()
+	}
+	if s.kvMod != nil {
+		c.dataDir = s.dataDir
+		c.EnableKV()
+	}
+	if s.secretsMod != nil {
+		c.EnableSecrets()
+	}
+	return c
+}
+
+func newScheduledJob(info JobInfo) (*scheduledJob, error) {
+	if info.Name == "" {
+		return nil, errors.New("jobs: name cannot be empty")
+	}
+	sched, err := cron.ParseStandard(info.Spec)
+	if err != nil {
+		return nil, fmt.Errorf("jobs: invalid schedule %q: %w", info.Spec, err)
+	}
+	info.Next = sched.Next(time.Now())
+	return &scheduledJob{JobInfo: info, schedule: sched}, nil
+}
+
+// load reads the jobs file once, later calls do nothing
+func (js *jobScheduler) load(dir string) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if js.loaded {
+		return nil
+	}
+	if dir == "" {
+		return errNoDataDir
+	}
+	js.jobs = map[string]*scheduledJob{}
+	js.history = map[string][]JobRun{}
+	js.wake = make(chan struct{}, 1)
+	buf, err := os.ReadFile(filepath.Join(dir, jobsFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		js.loaded = true
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var f jobsFile
+	if err := json.Unmarshal(buf, &f); err != nil {
+		return fmt.Errorf("jobs: %v: %w", jobsFileName, err)
+	}
+	for _, info := range f.Jobs {
+		j, err := newScheduledJob(info)
+		if err != nil {
+			return err
+		}
+		js.jobs[j.Name] = j
+	}
+	for name, runs := range f.History {
+		js.history[name] = runs
+	}
+	js.loaded = true
+	return nil
+}
+
+// save must be called with the lock held, the file is replaced
+// atomically so a crash never leaves it half written
+func (js *jobScheduler) save(dir string) error {
+	f := jobsFile{History: js.history}
+	for _, j := range js.jobs {
+		f.Jobs = append(f.Jobs, j.JobInfo)
+	}
+	sort.Slice(f.Jobs, func(i, k int) bool { return f.Jobs[i].Name < f.Jobs[k].Name })
+	buf, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, jobsFileName), buf)
+}
+
+func (js *jobScheduler) add(dir string, j *scheduledJob) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.jobs[j.Name] = j
+	js.notify()
+	return js.save(dir)
+}
+
+func (js *jobScheduler) remove(dir, name string) (bool, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if _, found := js.jobs[name]; !found {
+		return false, nil
+	}
+	delete(js.jobs, name)
+	delete(js.history, name)
+	js.notify()
+	return true, js.save(dir)
+}
+
+func (js *jobScheduler) list() []JobInfo {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	out := make([]JobInfo, 0, len(js.jobs))
+	for _, j := range js.jobs {
+		info := j.JobInfo
+		info.Runs = append([]JobRun(nil), js.history[j.Name]...)
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].Name < out[k].Name })
+	return out
+}
+
+func (js *jobScheduler) runs(name string) []JobRun {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	return append([]JobRun(nil), js.history[name]...)
+}
+
+// start marks the job as running, it fails if the job
+// does not exist or is already running
+func (js *jobScheduler) start(name string) (JobInfo, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	j, found := js.jobs[name]
+	if !found {
+		return JobInfo{}, errNoSuchJob
+	} else if j.Running {
+		return JobInfo{}, errJobBusy
+	}
+	j.Running = true
+	return j.JobInfo, nil
+}
+
+func (js *jobScheduler) finish(dir, name string, run JobRun) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	j, found := js.jobs[name]
+	if !found {
+		// removed while running
+		return nil
+	}
+	j.Running = false
+	runs := append(js.history[name], run)
+	if len(runs) > maxJobRuns {
+		runs = runs[len(runs)-maxJobRuns:]
+	}
+	js.history[name] = runs
+	return js.save(dir)
+}
+
+// due returns the jobs which should start now and
+// how long to wait for the next one
+func (js *jobScheduler) due(now time.Time) ([]string, time.Duration) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	var names []string
+	wait := time.Hour
+	for _, j := range js.jobs {
+		if !j.Next.After(now) {
+			j.Next = j.schedule.Next(now)
+			if !j.Running {
+				names = append(names, j.Name)
+			}
+		}
+		wait = min(wait, j.Next.Sub(now))
+	}
+	return names, wait
+}
+
+func (js *jobScheduler) notify() {
+	select {
+	case js.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (js *jobScheduler) loop(ctx context.Context, s *Shell) {
+	for {
+		names, wait := js.due(time.Now())
+		for _, name := range names {
+			if j, err := js.start(name); err == nil {
+				go s.runJob(ctx, j)
+			}
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-js.wake:
+		case <-t.C:
+		}
+		t.Stop()
+	}
+}
+
+func (r JobRun) object() tengo.Object {
+	return &tengo.ImmutableMap{Value: map[string]tengo.Object{
+		"start":    &tengo.Time{Value: r.Start},
+		"duration": &tengo.String{Value: r.Duration.String()},
+		"result":   &tengo.String{Value: r.Result},
+		"error":    &tengo.String{Value: r.Error},
+		"output":   &tengo.String{Value: r.Output},
+	}}
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if room := b.max - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+func (b *cappedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// writeFileAtomic replaces name with buf using a temporary file
+func writeFileAtomic(name string, buf []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
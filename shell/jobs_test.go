@@ -0,0 +1,217 @@
+package shell
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/d5/tengo/v2"
+)
+
+func TestJobsDue(t *testing.T) {
+	now := time.Date(2026, 1, 1, 2, 0, 0, 0, time.UTC)
+	job := func(name, spec string, next time.Time, running bool) *scheduledJob {
+		j, err := newScheduledJob(JobInfo{Name: name, Spec: spec})
+		if err != nil {
+			t.Fatal(err)
+		}
+		j.Next, j.Running = next, running
+		return j
+	}
+	js := &jobScheduler{jobs: map[string]*scheduledJob{}}
+	for _, j := range []*scheduledJob{
+		job("late", "0 2 * * *", now.Add(-time.Minute), false),
+		job("now", "@every 5m", now, false),
+		job("busy", "0 * * * *", now.Add(-time.Hour), true),
+		job("later", "0 3 * * *", now.Add(10*time.Minute), false),
+	} {
+		js.jobs[j.Name] = j
+	}
+	names, wait := js.due(now)
+	sort.Strings(names)
+	if strings.Join(names, ",") != "late,now" {
+		t.Fatalf("unexpected jobs due: %v", names)
+	}
+	if wait != 5*time.Minute {
+		t.Fatalf("expected to wait for the next run of now, got %v", wait)
+	}
+	for name, next := range map[string]time.Time{
+		"late":  now.Add(24 * time.Hour),
+		"now":   now.Add(5 * time.Minute),
+		"busy":  now.Add(time.Hour),
+		"later": now.Add(10 * time.Minute),
+	} {
+		if got := js.jobs[name].Next; !got.Equal(next) {
+			t.Errorf("%v: expected next run at %v, got %v", name, next, got)
+		}
+	}
+	if names, _ := js.due(now); len(names) != 0 {
+		t.Fatalf("jobs ran twice: %v", names)
+	}
+	if _, wait := (&jobScheduler{}).due(now); wait != time.Hour {
+		t.Fatalf("without jobs the scheduler should wake up hourly, got %v", wait)
+	}
+}
+
+func TestJobsPersisted(t *testing.T) {
+	s := newTestShell(t)
+	s.EnableJobs()
+	_, err := eval(t, s, `jobs := import("jobs")
+jobs.add("nightly", "0 2 * * *", "func() { return 1 + 1 }")
+jobs.add("hourly", "@hourly", "x := 1")
+jobs.run("nightly")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a new instance reads the same data directory
+	other := newTestShell(t)
+	other.SetDataDir(s.dataDir)
+	list := other.Jobs()
+	if len(list) != 2 || list[0].Name != "hourly" || list[1].Name != "nightly" {
+		t.Fatalf("unexpected jobs: %+v", list)
+	}
+	if runs := list[1].Runs; len(runs) != 1 || runs[0].Result != "2" {
+		t.Fatalf("history was not saved: %+v", runs)
+	}
+	if list[1].Next.IsZero() || list[1].Next.Hour() != 2 {
+		t.Fatalf("schedule was not restored: %v", list[1].Next)
+	}
+
+	if _, err := eval(t, s, `jobs.remove("hourly")`); err != nil {
+		t.Fatal(err)
+	}
+	again := newTestShell(t)
+	again.SetDataDir(s.dataDir)
+	if list := again.Jobs(); len(list) != 1 || list[0].Name != "nightly" {
+		t.Fatalf("removed job was loaded: %+v", list)
+	}
+}
+
+func TestJobsInvalid(t *testing.T) {
+	runScripts(t, (*Shell).EnableJobs, `jobs := import("jobs")`, []scriptTest{
+		{"empty name", `jobs.add("", "@hourly", "1")`, "", true},
+		{"bad spec", `jobs.add("a", "every day", "1")`, "", true},
+		{"bad source", `jobs.add("a", "@hourly", "func(")`, "", true},
+		{"source not a string", `jobs.add("a", "@hourly", func() {})`, "", true},
+		{"run missing", `jobs.run("missing")`, "", true},
+		{"remove missing", `jobs.remove("missing")`, "false", false},
+		{"history missing", `len(jobs.history("missing"))`, "0", false},
+	})
+
+	s := newTestShell(t)
+	if err := os.WriteFile(filepath.Join(s.dataDir, jobsFileName), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StartJobs(context.Background()); err == nil {
+		t.Fatal("a corrupt jobs file should not load")
+	}
+}
+
+func TestJobsRunSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		result string
+		output string
+		fail   bool
+	}{
+		{name: "script", source: `fmt := import("fmt"); fmt.print("hi")`, output: "hi"},
+		{name: "function", source: `func() { return "done" }`, result: "done"},
+		{name: "function output", source: "func() {\n\timport(\"fmt\").print(\"x\")\n\treturn 3\n}", result: "3", output: "x"},
+		{name: "no echo", source: `a := 1; a`},
+		{name: "compile error", source: `a +`, fail: true},
+		{name: "runtime error", source: `func() { return undefined() }`, fail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestShell(t)
+			var out strings.Builder
+			res, err := s.runSource(context.Background(), &out, tt.source)
+			if tt.fail {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result string
+			if res != nil && res != tengo.UndefinedValue {
+				result, _ = tengo.ToString(res)
+			}
+			if result != tt.result || out.String() != tt.output {
+				t.Fatalf("expected %q and output %q, got %q and %q", tt.result, tt.output, result, out.String())
+			}
+		})
+	}
+}
+
+func TestJobsLoop(t *testing.T) {
+	s := newTestShell(t)
+	s.EnableJobs()
+	if _, err := eval(t, s, `import("jobs").add("tick", "@every 1s", "func() { return 1 }")`); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.StartJobs(ctx); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if list := s.Jobs(); len(list) == 1 && len(list[0].Runs) > 0 {
+			if run := list[0].Runs[0]; run.Result != "1" || run.Error != "" {
+				t.Fatalf("unexpected run: %+v", run)
+			}
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("the job never ran")
+}
+
+func TestJobsPolicy(t *testing.T) {
+	s := newTestShell(t)
+	s.EnableJobs()
+	s.EnableExec()
+	s.SetPolicy(&Policy{Modules: []string{"*"}, FSRoots: []string{s.importsDir}})
+	// granted to the interactive session only
+	s.Grant(CapExec, mustLookPath(t, "echo"))
+	s.SetPermissionPrompt(func(context.Context, PermissionRequest) Decision {
+		t.Error("jobs must not prompt")
+		return AllowSession
+	})
+	out, err := eval(t, s, `jobs := import("jobs")
+jobs.add("echo", "@yearly", "func() { return import(\"exec\").run(\"echo\", {args: [\"hi\"], quiet: true}).stdout }")
+jobs.run("echo")["error"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "not allowed") {
+		t.Fatalf("session grants were used by the job: %v", out)
+	}
+
+	s.SetPolicy(&Policy{Modules: []string{"*"}, Executables: []string{"echo"}, FSRoots: []string{s.importsDir}})
+	if _, err := eval(t, s, `jobs.run("echo")`); err != nil {
+		t.Fatal(err)
+	}
+	runs := s.Jobs()[0].Runs
+	if got := strings.TrimSpace(runs[len(runs)-1].Result); got != "hi" {
+		t.Fatalf("policy grants were not used by the job: %q", got)
+	}
+}
+
+func mustLookPath(t *testing.T, name string) string {
+	t.Helper()
+	path, err := lookExecutable(name)
+	if err != nil {
+		t.Skip(err)
+	}
+	return path
+}
@@ -2,6 +2,7 @@ package shell
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -28,9 +29,16 @@ type (
 	}
 )
 
+const (
+	internalRPCErrorCode = -32603
+)
+
 func (s *Shell) EnableJSONRPCClient() {
-	const internalRPCErrorCode = -32603
 	callCount := uint64(0)
+	nextID := func() string {
+		callCount++
+		return strconv.FormatUint(callCount, 36)
+	}
 	s.jsonrpcMod = map[string]tengo.Object{
 		"call": &tengo.UserFunction{
 			Name: "call",
@@ -38,45 +46,14 @@ func (s *Shell) EnableJSONRPCClient() {
 				if len(args) != 3 {
 					return tengo.UndefinedValue, tengo.ErrWrongNumArguments
 				}
-				endpoint, ok := tengo.ToString(args[0])
-				if !ok {
-					return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
-						Name:     "endpoint",
-						Expected: "string",
-						Found:    args[0].TypeName(),
-					}
-				}
-				method, ok := tengo.ToString(args[1])
-				if !ok {
-					return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
-						Name:     "endpoint",
-						Expected: "string",
-						Found:    args[0].TypeName(),
-					}
-				}
-				params, err := json.Marshal(tengo.ToInterface(args[2]))
+				endpoint, jreq, err := jsonrpcRequest(nextID(), args...)
 				if err != nil {
-					return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
-						Name:     "params",
-						Expected: "any (json serializable)",
-						Found:    args[2].TypeName(),
-					}
-				}
-
-				callCount++
-				jreq := jsonRPCReq{
-					Version: "2.0",
-					Method:  method,
-					Params:  json.RawMessage(params),
-					ID:      strconv.FormatUint(callCount, 36),
+					return tengo.UndefinedValue, err
 				}
-				buf, _ := json.Marshal(jreq)
-
-				req, err := http.NewRequestWithContext(s.ctx, "POST", endpoint, bytes.NewBuffer(buf))
-				if err != nil {
+				if err := s.checkRPCParams(endpoint, jreq); err != nil {
 					return tengo.UndefinedValue, err
 				}
-				res, err := http.DefaultClient.Do(req)
+				res, err := s.jsonrpcPost(s.ctx, endpoint, jreq, "application/json")
 				if err != nil {
 					return tengo.UndefinedValue, err
 				}
@@ -89,21 +66,81 @@ func (s *Shell) EnableJSONRPCClient() {
 				} else {
 					json.NewDecoder(res.Body).Decode(&reply)
 				}
+				return reply.value()
+			}),
+		},
+		"stream": &tengo.UserFunction{
+			Name:  "stream",
+			Value: s.jsonrpcStream(nextID),
+		},
+		"profile": &tengo.UserFunction{
+			Name:  "profile",
+			Value: s.jsonrpcProfile,
+		},
+	}
+}
 
-				if reply.Error.Code != 0 {
-					return tengo.UndefinedValue, fmt.Errorf("[json-rpc-error: %v] %v", reply.Error.Code, reply.Error.Message)
-				} else if reply.Result == nil {
-					return tengo.UndefinedValue, fmt.Errorf("[json-rpc-error: %v] %v", internalRPCErrorCode, "empty result")
-				}
+func jsonrpcRequest(id string, args ...tengo.Object) (string, jsonRPCReq, error) {
+	endpoint, ok := tengo.ToString(args[0])
+	if !ok {
+		return "", jsonRPCReq{}, tengo.ErrInvalidArgumentType{
+			Name:     "endpoint",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+	}
+	method, ok := tengo.ToString(args[1])
+	if !ok {
+		return "", jsonRPCReq{}, tengo.ErrInvalidArgumentType{
+			Name:     "method",
+			Expected: "string",
+			Found:    args[1].TypeName(),
+		}
+	}
+	params, err := json.Marshal(tengo.ToInterface(args[2]))
+	if err != nil {
+		return "", jsonRPCReq{}, tengo.ErrInvalidArgumentType{
+			Name:     "params",
+			Expected: "any (json serializable)",
+			Found:    args[2].TypeName(),
+		}
+	}
+	return endpoint, jsonRPCReq{
+		Version: "2.0",
+		Method:  method,
+		Params:  json.RawMessage(params),
+		ID:      id,
+	}, nil
+}
 
-				var out any
-				err = json.Unmarshal(*reply.Result, &out)
-				if err != nil {
-					return tengo.UndefinedValue, fmt.Errorf("[json-rpc-error: %v] decoding error: %v", internalRPCErrorCode, err)
-				}
+func (s *Shell) jsonrpcPost(ctx context.Context, endpoint string, jreq jsonRPCReq, accept string) (*http.Response, error) {
+	if err := s.allowURL(CapRPC, endpoint); err != nil {
+		return nil, err
+	}
+	buf, _ := json.Marshal(jreq)
 
-				return tengo.FromInterface(out)
-			}),
-		},
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(buf))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", accept)
+	s.rpcProfiles.apply(endpoint, req)
+	return s.httpClient().Do(req)
+}
+
+func (r *jsonRPCReply) value() (tengo.Object, error) {
+	if r.Error.Code != 0 {
+		return tengo.UndefinedValue, fmt.Errorf("[json-rpc-error: %v] %v", r.Error.Code, r.Error.Message)
+	} else if r.Result == nil {
+		return tengo.UndefinedValue, fmt.Errorf("[json-rpc-error: %v] %v", internalRPCErrorCode, "empty result")
+	}
+
+	var out any
+	err := json.Unmarshal(*r.Result, &out)
+	if err != nil {
+		return tengo.UndefinedValue, fmt.Errorf("[json-rpc-error: %v] decoding error: %v", internalRPCErrorCode, err)
 	}
+
+	return tengo.FromInterface(out)
 }
@@ -0,0 +1,311 @@
+package shell
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/andrebq/appshell/internal/filelock"
+	"github.com/d5/tengo/v2"
+)
+
+type (
+	// kvData maps keys to their json encoded values
+	kvData map[string]json.RawMessage
+
+	// kvTx gives access to the store while its file is locked,
+	// changes are only written once the transaction finishes
+	kvTx struct {
+		data    kvData
+		changed bool
+		done    bool
+	}
+
+	kvOp func(tx *kvTx, args ...tengo.Object) (tengo.Object, error)
+)
+
+const (
+	kvFileName = "kv.json"
+)
+
+var (
+	errTxDone   = errors.New("kv: transaction already finished")
+	errTxNested = errors.New("kv: transactions cannot be nested")
+)
+
+// EnableKV exposes the kv module to scripts, values are saved in
+// the directory configured by SetDataDir and the file is locked
+// while in use, so multiple instances can share it
+func (s *Shell) EnableKV() {
+	s.kvMod = map[string]tengo.Object{
+		"get":    s.kvFunc("get", false, (*kvTx).get),
+		"set":    s.kvFunc("set", true, (*kvTx).set),
+		"delete": s.kvFunc("delete", true, (*kvTx).delete),
+		"keys":   s.kvFunc("keys", false, (*kvTx).keys),
+		"list":   s.kvFunc("list", false, (*kvTx).list),
+		"transaction": &tengo.UserFunction{
+			Name:  "transaction",
+			Value: s.kvTransaction,
+		},
+	}
+}
+
+// kvFunc runs op in its own transaction, or as part of the transaction
+// in progress, whose lock would otherwise never be released
+func (s *Shell) kvFunc(name string, write bool, op kvOp) *tengo.UserFunction {
+	return &tengo.UserFunction{
+		Name: name,
+		Value: func(args ...tengo.Object) (tengo.Object, error) {
+			if s.kvActive != nil {
+				return op(s.kvActive, args...)
+			}
+			var ret tengo.Object
+			err := s.kvUpdate(write, func(tx *kvTx) error {
+				var err error
+				ret, err = op(tx, args...)
+				return err
+			})
+			if err != nil {
+				return tengo.UndefinedValue, err
+			}
+			return ret, nil
+		},
+	}
+}
+
+// kvTransaction implements transaction(fn), fn receives an object with
+// the same functions as the module. Nothing is saved if fn fails or
+// returns an error, otherwise all changes are saved at once
+func (s *Shell) kvTransaction(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	fn, err := callableArg(args[0], "fn")
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	if s.kvActive != nil {
+		return tengo.UndefinedValue, errTxNested
+	}
+	var ret tengo.Object
+	err = s.kvUpdate(true, func(tx *kvTx) error {
+		s.kvActive = tx
+		defer func() { s.kvActive = nil }()
+		var err error
+		ret, err = s.call(fn, tx.object())
+		if err != nil {
+			return err
+		}
+		if _, failed := ret.(*tengo.Error); failed {
+			tx.changed = false
+		}
+		return nil
+	})
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	return ret, nil
+}
+
+// kvUpdate locks the store, shared for reads and exclusive for writes,
+// and saves the data if fn changed it
+func (s *Shell) kvUpdate(write bool, fn func(tx *kvTx) error) error {
+	if s.dataDir == "" {
+		return errNoDataDir
+	}
+	name := filepath.Join(s.dataDir, kvFileName)
+	lock, err := os.OpenFile(name+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := filelock.Lock(s.ctx, lock, write); err != nil {
+		return err
+	}
+	defer filelock.Unlock(lock)
+
+	tx := &kvTx{data: kvData{}}
+	defer func() { tx.done = true }()
+	buf, err := os.ReadFile(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	} else if err == nil {
+		if err := json.Unmarshal(buf, &tx.data); err != nil {
+			return fmt.Errorf("kv: %v: %w", kvFileName, err)
+		}
+	}
+	if err := fn(tx); err != nil || !tx.changed {
+		return err
+	}
+	buf, err = json.MarshalIndent(tx.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(name, buf)
+}
+
+// get implements get(key, [default])
+func (tx *kvTx) get(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	key, err := kvKeyArg(args[0])
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	raw, found := tx.data[key]
+	if !found {
+		if len(args) == 2 {
+			return args[1], nil
+		}
+		return tengo.UndefinedValue, nil
+	}
+	return kvValue(raw)
+}
+
+// set implements set(key, value), value can be anything a snapshot keeps
+func (tx *kvTx) set(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 2 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	key, err := kvKeyArg(args[0])
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	sp := snapshot{seen: map[tengo.Object]any{}}
+	val, ok := sp.takeOne(args[1])
+	if !ok {
+		return tengo.UndefinedValue, fmt.Errorf("kv: values of type %v cannot be stored", args[1].TypeName())
+	}
+	buf, err := json.Marshal(val)
+	if err != nil {
+		return tengo.UndefinedValue, fmt.Errorf("kv: %w", err)
+	}
+	tx.data[key] = buf
+	tx.changed = true
+	return tengo.UndefinedValue, nil
+}
+
+// delete implements delete(key), returning true if the key existed
+func (tx *kvTx) delete(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	key, err := kvKeyArg(args[0])
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	_, found := tx.data[key]
+	if found {
+		delete(tx.data, key)
+		tx.changed = true
+	}
+	return boolObject(found), nil
+}
+
+// keys implements keys([prefix]), returning the sorted keys
+func (tx *kvTx) keys(args ...tengo.Object) (tengo.Object, error) {
+	keys, err := tx.prefixed(args...)
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	out := &tengo.Array{Value: make([]tengo.Object, 0, len(keys))}
+	for _, k := range keys {
+		out.Value = append(out.Value, &tengo.String{Value: k})
+	}
+	return out, nil
+}
+
+// list implements list([prefix]), returning {key, value} maps sorted by key
+func (tx *kvTx) list(args ...tengo.Object) (tengo.Object, error) {
+	keys, err := tx.prefixed(args...)
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	out := &tengo.Array{Value: make([]tengo.Object, 0, len(keys))}
+	for _, k := range keys {
+		val, err := kvValue(tx.data[k])
+		if err != nil {
+			return tengo.UndefinedValue, err
+		}
+		out.Value = append(out.Value, &tengo.Map{Value: map[string]tengo.Object{
+			"key":   &tengo.String{Value: k},
+			"value": val,
+		}})
+	}
+	return out, nil
+}
+
+func (tx *kvTx) prefixed(args ...tengo.Object) ([]string, error) {
+	if len(args) > 1 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	var prefix string
+	if len(args) == 1 {
+		str, ok := args[0].(*tengo.String)
+		if !ok {
+			return nil, tengo.ErrInvalidArgumentType{
+				Name:     "prefix",
+				Expected: "string",
+				Found:    args[0].TypeName(),
+			}
+		}
+		prefix = str.Value
+	}
+	var keys []string
+	for k := range tx.data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (tx *kvTx) object() tengo.Object {
+	wrap := func(name string, op kvOp) *tengo.UserFunction {
+		return &tengo.UserFunction{
+			Name: name,
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if tx.done {
+					return tengo.UndefinedValue, errTxDone
+				}
+				return op(tx, args...)
+			},
+		}
+	}
+	return &tengo.ImmutableMap{Value: map[string]tengo.Object{
+		"get":    wrap("get", (*kvTx).get),
+		"set":    wrap("set", (*kvTx).set),
+		"delete": wrap("delete", (*kvTx).delete),
+		"keys":   wrap("keys", (*kvTx).keys),
+		"list":   wrap("list", (*kvTx).list),
+	}}
+}
+
+func kvKeyArg(arg tengo.Object) (string, error) {
+	key, ok := arg.(*tengo.String)
+	if !ok {
+		return "", tengo.ErrInvalidArgumentType{
+			Name:     "key",
+			Expected: "string",
+			Found:    arg.TypeName(),
+		}
+	}
+	if key.Value == "" {
+		return "", errors.New("kv: key cannot be empty")
+	}
+	return key.Value, nil
+}
+
+func kvValue(raw json.RawMessage) (tengo.Object, error) {
+	val, err := decodeJSONNumbers(raw)
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	return tengo.FromInterface(normalize(val))
+}
@@ -0,0 +1,58 @@
+package shell
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestKV(t *testing.T) {
+	runScripts(t, (*Shell).EnableKV, `kv := import("kv")`, []scriptTest{
+		{"get missing", `is_undefined(kv.get("a"))`, "true", false},
+		{"get default", `kv.get("a", 10)`, "10", false},
+		{"set and get", `kv.set("a", {b: [1, 2]}); kv.get("a").b[1]`, "2", false},
+		{"delete", `kv.set("a", 1); [kv.delete("a"), kv.delete("a"), is_undefined(kv.get("a"))]`, "[true, false, true]", false},
+		{"keys", `kv.set("x.1", 1); kv.set("x.2", 2); kv.set("y", 3); kv.keys("x.")`, `["x.1", "x.2"]`, false},
+		{"list", `kv.set("k", "v"); kv.list()[0].value`, "v", false},
+		{"empty key", `kv.set("", 1)`, "", true},
+		{"functions are rejected", `kv.set("f", func() {})`, "", true},
+		{"transaction", `kv.transaction(func(tx) { tx.set("a", 1); return tx.get("a") + 1 })`, "2", false},
+		{"rollback", `kv.transaction(func(tx) { tx.set("a", 1); return error("no") }); is_undefined(kv.get("a"))`, "true", false},
+		{"module inside transaction", `kv.transaction(func(tx) { kv.set("a", 5); return kv.get("a") + tx.get("a") })`, "10", false},
+		{"module changes are part of the transaction", `kv.transaction(func(tx) { kv.set("a", 5); return error("no") }); is_undefined(kv.get("a"))`, "true", false},
+		{"nested transaction", `kv.transaction(func(tx) { return kv.transaction(func(tx2) {}) })`, "", true},
+		{"finished transaction", `t := undefined; kv.transaction(func(tx) { t = tx }); t.get("a")`, "", true},
+	})
+}
+
+func TestKVConcurrentInstances(t *testing.T) {
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		s := newTestShell(t)
+		s.SetDataDir(dir)
+		s.EnableKV()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := eval(t, s, `kv := import("kv")
+for i := 0; i < 10; i++ {
+	kv.transaction(func(tx) { tx.set("n", tx.get("n", 0) + 1) })
+}`)
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	s := newTestShell(t)
+	s.SetDataDir(dir)
+	s.EnableKV()
+	out, err := eval(t, s, `kv := import("kv"); kv.get("n")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(strings.TrimSpace(out), "40") {
+		t.Fatalf("expected 40 increments, got %v", out)
+	}
+}
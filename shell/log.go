@@ -0,0 +1,94 @@
+package shell
+
+import (
+	"log/slog"
+
+	"github.com/d5/tengo/v2"
+)
+
+// SetLogHandler configures where records from the log module go,
+// when no handler is set records are written as text to stderr
+func (s *Shell) SetLogHandler(h slog.Handler) {
+	s.logHandler = h
+}
+
+// LogHandler returns the handler configured by SetLogHandler
+func (s *Shell) LogHandler() slog.Handler {
+	return s.logHandler
+}
+
+func (s *Shell) logger() *slog.Logger {
+	if s.logHandler != nil {
+		return slog.New(s.logHandler)
+	}
+	return slog.New(slog.NewTextHandler(&s.stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func (s *Shell) logModule() map[string]tengo.Object {
+	level := func(name string, lvl slog.Level) *tengo.UserFunction {
+		return &tengo.UserFunction{
+			Name: name,
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				return s.logRecord(lvl, args...)
+			},
+		}
+	}
+	return map[string]tengo.Object{
+		"debug": level("debug", slog.LevelDebug),
+		"info":  level("info", slog.LevelInfo),
+		"warn":  level("warn", slog.LevelWarn),
+		"error": level("error", slog.LevelError),
+	}
+}
+
+// logRecord accepts (msg, [key, value]...) or (msg, attrs)
+func (s *Shell) logRecord(lvl slog.Level, args ...tengo.Object) (tengo.Object, error) {
+	if len(args) == 0 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	msg, ok := tengo.ToString(args[0])
+	if !ok {
+		return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+			Name:     "msg",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+	}
+	var attrs []slog.Attr
+	rest := args[1:]
+	if len(rest) == 1 {
+		m, ok := tengo.ToInterface(rest[0]).(map[string]any)
+		if !ok {
+			return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+				Name:     "attrs",
+				Expected: "map",
+				Found:    rest[0].TypeName(),
+			}
+		}
+		for k, v := range m {
+			attrs = append(attrs, slog.Any(k, v))
+		}
+	} else {
+		if len(rest)%2 != 0 {
+			return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+		}
+		for i := 0; i < len(rest); i += 2 {
+			key, ok := tengo.ToString(rest[i])
+			if !ok {
+				return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+					Name:     "key",
+					Expected: "string",
+					Found:    rest[i].TypeName(),
+				}
+			}
+			attrs = append(attrs, slog.Any(key, tengo.ToInterface(rest[i+1])))
+		}
+	}
+	// the sensitive variables might have changed during this evaluation
+	s.captureSensitive()
+	for i, a := range attrs {
+		attrs[i].Value = slog.AnyValue(s.redactValue(a.Value.Any()))
+	}
+	s.logger().LogAttrs(s.ctx, lvl, s.Redact(msg), attrs...)
+	return tengo.UndefinedValue, nil
+}
@@ -0,0 +1,271 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/d5/tengo/v2"
+)
+
+type (
+	// Capability identifies the kind of resource a script is trying to use
+	Capability string
+
+	// Policy declares which capabilities a session may use.
+	//
+	// A nil Policy grants everything, otherwise only what is listed
+	// is allowed. "*" can be used in any list to allow everything
+	// of that kind.
+	Policy struct {
+		// Modules lists the modules scripts may import
+		Modules []string `json:"modules"`
+		// RPCHosts lists host patterns (see path.Match) which
+		// can be reached by the jsonrpc and http modules,
+		// patterns are matched against host:port and host
+		RPCHosts []string `json:"rpcHosts"`
+		// FSRoots lists the directories the fs module may touch
+		FSRoots []string `json:"fsRoots"`
+		// Listen lists the addresses scripts may listen on
+		Listen []string `json:"listen"`
+		// Executables lists the programs which can be executed,
+		// either as absolute paths or names looked up in PATH
+		Executables []string `json:"executables"`
+	}
+
+	// AuditEntry records a request which was denied by the policy
+	AuditEntry struct {
+		Time       time.Time  `json:"time"`
+		Capability Capability `json:"capability"`
+		Resource   string     `json:"resource"`
+	}
+
+	// PermissionRequest describes a resource the policy does not grant
+	PermissionRequest struct {
+		Capability Capability
+		Resource   string
+	}
+
+	// Decision is the answer given by a PermissionPrompt
+	Decision int
+
+	// PermissionPrompt is called while the script is paused, whenever
+	// it tries to use a resource not granted by the policy
+	PermissionPrompt func(ctx context.Context, req PermissionRequest) Decision
+
+	// PermissionError is returned to scripts whenever the policy
+	// denies access to a resource
+	PermissionError struct {
+		Capability Capability
+		Resource   string
+	}
+
+	policyModules struct {
+		s    *Shell
+		mods *tengo.ModuleMap
+	}
+
+	deniedModule struct {
+		err error
+	}
+
+	sessionGrants struct {
+		sync.Mutex
+		granted map[PermissionRequest]struct{}
+	}
+
+	auditLog struct {
+		sync.Mutex
+		entries []AuditEntry
+		hook    func(AuditEntry)
+	}
+)
+
+const (
+	CapModule Capability = "module"
+	CapRPC    Capability = "rpc"
+	CapFS     Capability = "fs"
+	CapExec   Capability = "exec"
+	CapListen Capability = "listen"
+
+	maxAuditEntries = 1000
+)
+
+const (
+	Deny Decision = iota
+	AllowOnce
+	AllowSession
+)
+
+func (p *PermissionError) Error() string {
+	return fmt.Sprintf("policy: %v %q is not allowed", p.Capability, p.Resource)
+}
+
+// SetPolicy restricts what scripts are allowed to do,
+// passing nil removes all restrictions
+func (s *Shell) SetPolicy(p *Policy) {
+	s.policy = p
+}
+
+// SetPermissionPrompt registers a function which is asked to decide
+// about requests not granted by the policy
+func (s *Shell) SetPermissionPrompt(fn PermissionPrompt) {
+	s.prompt = fn
+}
+
+// Grant allows the resource until the shell is discarded
+func (s *Shell) Grant(c Capability, resource string) {
+	s.grants.Lock()
+	defer s.grants.Unlock()
+	if s.grants.granted == nil {
+		s.grants.granted = make(map[PermissionRequest]struct{})
+	}
+	s.grants.granted[PermissionRequest{Capability: c, Resource: resource}] = struct{}{}
+}
+
+// OnAudit registers a function which is called for every
+// request denied by the policy
+func (s *Shell) OnAudit(fn func(AuditEntry)) {
+	s.audit.Lock()
+	defer s.audit.Unlock()
+	s.audit.hook = fn
+}
+
+// AuditLog returns the most recent requests denied by the policy
+func (s *Shell) AuditLog() []AuditEntry {
+	s.audit.Lock()
+	defer s.audit.Unlock()
+	return append([]AuditEntry(nil), s.audit.entries...)
+}
+
+// allow checks if the policy grants access to resource,
+// without a policy everything is allowed
+func (s *Shell) allow(c Capability, resource string) error {
+	if s.policy == nil {
+		return nil
+	}
+	return s.request(c, resource)
+}
+
+// request checks if resource was explicitly granted, either by the policy,
+// a previous decision or by asking the permission prompt.
+//
+// denied requests are recorded in the audit log
+func (s *Shell) request(c Capability, resource string) error {
+	if s.policy != nil && s.policy.grants(c, resource) {
+		return nil
+	}
+	req := PermissionRequest{Capability: c, Resource: resource}
+	s.grants.Lock()
+	_, granted := s.grants.granted[req]
+	s.grants.Unlock()
+	if granted {
+		return nil
+	}
+	if s.prompt != nil {
+		switch s.prompt(s.ctx, req) {
+		case AllowOnce:
+			return nil
+		case AllowSession:
+			s.Grant(c, resource)
+			return nil
+		}
+	}
+
+	s.recordAudit(AuditEntry{Time: time.Now(), Capability: c, Resource: resource})
+	return &PermissionError{Capability: c, Resource: resource}
+}
+
+func (s *Shell) recordAudit(entry AuditEntry) {
+	s.audit.Lock()
+	s.audit.entries = append(s.audit.entries, entry)
+	if len(s.audit.entries) > maxAuditEntries {
+		s.audit.entries = s.audit.entries[len(s.audit.entries)-maxAuditEntries:]
+	}
+	hook := s.audit.hook
+	s.audit.Unlock()
+	if hook != nil {
+		hook(entry)
+	}
+}
+
+// allowURL checks if the host of rawURL can be reached
+func (s *Shell) allowURL(c Capability, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	return s.allow(c, u.Host)
+}
+
+func (p *Policy) grants(c Capability, resource string) bool {
+	switch c {
+	case CapModule:
+		return matchAny(p.Modules, func(m string) bool { return m == resource })
+	case CapRPC:
+		hostname := resource
+		if u, err := url.Parse("//" + resource); err == nil {
+			hostname = u.Hostname()
+		}
+		return matchAny(p.RPCHosts, func(pattern string) bool {
+			if ok, _ := path.Match(pattern, resource); ok {
+				return true
+			}
+			ok, _ := path.Match(pattern, hostname)
+			return ok
+		})
+	case CapFS:
+		return matchAny(p.FSRoots, func(root string) bool {
+			root, err := filepath.Abs(root)
+			if err != nil {
+				return false
+			}
+			if real, err := filepath.EvalSymlinks(root); err == nil {
+				root = real
+			}
+			return within(root, resource)
+		})
+	case CapListen:
+		return matchAny(p.Listen, func(addr string) bool { return addr == resource })
+	case CapExec:
+		return matchAny(p.Executables, func(e string) bool {
+			if e == resource {
+				return true
+			}
+			path, err := exec.LookPath(e)
+			return err == nil && path == resource
+		})
+	}
+	return false
+}
+
+func matchAny(list []string, match func(string) bool) bool {
+	for _, v := range list {
+		if v == "*" || match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the module only if the policy allows it, otherwise the
+// returned module fails to import, making the compilation fail
+func (p policyModules) Get(name string) tengo.Importable {
+	mod := p.mods.Get(name)
+	if mod == nil {
+		return nil
+	}
+	if err := p.s.allow(CapModule, name); err != nil {
+		return deniedModule{err: err}
+	}
+	return mod
+}
+
+func (d deniedModule) Import(string) (interface{}, error) {
+	return nil, d.err
+}
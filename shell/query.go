@@ -0,0 +1,1130 @@
+package shell
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/d5/tengo/v2"
+)
+
+type (
+	// queryPath is a compiled JSONPath expression, the supported syntax is:
+	// $ (or @) the root, .name, ['name', ...], .* or [*], ..name (recursive),
+	// [0, -1], [start:end:step] and [?(filter)]
+	queryPath struct {
+		expr  string
+		steps []queryStep
+	}
+
+	queryStep struct {
+		recursive bool
+		sel       querySelector
+	}
+
+	querySelector interface {
+		apply(root, node tengo.Object, out []tengo.Object) []tengo.Object
+	}
+
+	selectName     []string
+	selectWildcard struct{}
+	selectIndex    []int
+	selectSlice    struct {
+		start, end *int
+		step       int
+	}
+	selectFilter struct {
+		filter queryFilter
+	}
+
+	// queryFilter is an expression used by [?(...)] and query.select,
+	// for example: @.price > 10 && @.tags[0] == 'new'
+	queryFilter interface {
+		value(root, cur tengo.Object) tengo.Object
+	}
+
+	filterPath struct {
+		relative bool
+		path     *queryPath
+	}
+	filterLiteral struct {
+		v tengo.Object
+	}
+	filterNot struct {
+		x queryFilter
+	}
+	filterBinary struct {
+		op   string
+		l, r queryFilter
+		re   *regexp.Regexp
+	}
+
+	queryParser struct {
+		src string
+		pos int
+	}
+
+	// queryObject is returned by query.compile, calling it is
+	// the same as calling query.get with it
+	queryObject struct {
+		tengo.ObjectImpl
+		path *queryPath
+	}
+
+	queryCacheKey struct {
+		filter bool
+		expr   string
+	}
+)
+
+const (
+	maxCachedQueries = 512
+)
+
+var (
+	queryCache = struct {
+		sync.Mutex
+		items map[queryCacheKey]any
+	}{items: map[queryCacheKey]any{}}
+)
+
+func (s *Shell) queryModule() map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"compile": &tengo.UserFunction{
+			Name: "compile",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 1 {
+					return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+				}
+				path, err := queryArg(args[0])
+				if err != nil {
+					return tengo.UndefinedValue, err
+				}
+				return &queryObject{path: path}, nil
+			},
+		},
+		"get": &tengo.UserFunction{
+			Name: "get",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 2 {
+					return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+				}
+				path, err := queryArg(args[1])
+				if err != nil {
+					return tengo.UndefinedValue, err
+				}
+				return path.get(args[0]), nil
+			},
+		},
+		"first": &tengo.UserFunction{
+			Name: "first",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 2 {
+					return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+				}
+				path, err := queryArg(args[1])
+				if err != nil {
+					return tengo.UndefinedValue, err
+				}
+				return path.first(args[0]), nil
+			},
+		},
+		"select":   &tengo.UserFunction{Name: "select", Value: s.querySelect},
+		"map":      &tengo.UserFunction{Name: "map", Value: s.queryMap},
+		"group_by": &tengo.UserFunction{Name: "group_by", Value: s.queryGroupBy},
+		"sort_by":  &tengo.UserFunction{Name: "sort_by", Value: s.querySortBy},
+		"flatten":  &tengo.UserFunction{Name: "flatten", Value: queryFlatten},
+	}
+}
+
+// querySelect implements select(arr, pred), pred is either a function
+// or a filter expression like "@.status == 'active'"
+func (s *Shell) querySelect(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 2 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	items, err := arrayArg(args[0], "value")
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	var pred func(tengo.Object) (bool, error)
+	if str, ok := args[1].(*tengo.String); ok {
+		filter, err := compileFilter(str.Value)
+		if err != nil {
+			return tengo.UndefinedValue, err
+		}
+		pred = func(v tengo.Object) (bool, error) {
+			return !filter.value(v, v).IsFalsy(), nil
+		}
+	} else {
+		fn, err := callableArg(args[1], "pred")
+		if err != nil {
+			return tengo.UndefinedValue, err
+		}
+		pred = func(v tengo.Object) (bool, error) {
+			ret, err := s.call(fn, v)
+			return err == nil && !ret.IsFalsy(), err
+		}
+	}
+	out := &tengo.Array{Value: []tengo.Object{}}
+	for _, v := range items {
+		ok, err := pred(v)
+		if err != nil {
+			return tengo.UndefinedValue, err
+		}
+		if ok {
+			out.Value = append(out.Value, v)
+		}
+	}
+	return out, nil
+}
+
+func (s *Shell) queryMap(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 2 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	items, err := arrayArg(args[0], "value")
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	key, err := s.keyFunc(args[1])
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	out := &tengo.Array{Value: make([]tengo.Object, 0, len(items))}
+	for _, v := range items {
+		mapped, err := key(v)
+		if err != nil {
+			return tengo.UndefinedValue, err
+		}
+		out.Value = append(out.Value, mapped)
+	}
+	return out, nil
+}
+
+// queryGroupBy returns a map from the string form of each key
+// to the items which produced it, in their original order
+func (s *Shell) queryGroupBy(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 2 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	items, err := arrayArg(args[0], "value")
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	key, err := s.keyFunc(args[1])
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	groups := map[string]tengo.Object{}
+	for _, v := range items {
+		k, err := key(v)
+		if err != nil {
+			return tengo.UndefinedValue, err
+		}
+		name, _ := tengo.ToString(k)
+		group, ok := groups[name].(*tengo.Array)
+		if !ok {
+			group = &tengo.Array{}
+			groups[name] = group
+		}
+		group.Value = append(group.Value, v)
+	}
+	return &tengo.Map{Value: groups}, nil
+}
+
+// querySortBy implements sort_by(arr, key, [desc]), the sort is stable
+// and the input is left untouched
+func (s *Shell) querySortBy(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	items, err := arrayArg(args[0], "value")
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	key, err := s.keyFunc(args[1])
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	desc := len(args) == 3 && !args[2].IsFalsy()
+
+	type keyed struct {
+		key, v tengo.Object
+	}
+	sorted := make([]keyed, len(items))
+	for i, v := range items {
+		k, err := key(v)
+		if err != nil {
+			return tengo.UndefinedValue, err
+		}
+		sorted[i] = keyed{key: k, v: v}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if desc {
+			return orderObjects(sorted[j].key, sorted[i].key) < 0
+		}
+		return orderObjects(sorted[i].key, sorted[j].key) < 0
+	})
+	out := &tengo.Array{Value: make([]tengo.Object, len(sorted))}
+	for i, k := range sorted {
+		out.Value[i] = k.v
+	}
+	return out, nil
+}
+
+// queryFlatten implements flatten(arr, [depth]), depth defaults to 1
+// and a negative depth flattens every level
+func queryFlatten(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	items, err := arrayArg(args[0], "value")
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	depth := 1
+	if len(args) == 2 {
+		d, ok := tengo.ToInt(args[1])
+		if !ok {
+			return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+				Name:     "depth",
+				Expected: "int",
+				Found:    args[1].TypeName(),
+			}
+		}
+		depth = d
+	}
+	var flatten func(items []tengo.Object, depth int, out []tengo.Object) []tengo.Object
+	flatten = func(items []tengo.Object, depth int, out []tengo.Object) []tengo.Object {
+		for _, v := range items {
+			if inner, ok := arrayValue(v); ok && depth != 0 {
+				out = flatten(inner, depth-1, out)
+				continue
+			}
+			out = append(out, v)
+		}
+		return out
+	}
+	return &tengo.Array{Value: flatten(items, depth, []tengo.Object{})}, nil
+}
+
+// keyFunc accepts a function or a path evaluated against each item
+func (s *Shell) keyFunc(arg tengo.Object) (func(tengo.Object) (tengo.Object, error), error) {
+	switch arg.(type) {
+	case *tengo.String, *queryObject:
+		path, err := queryArg(arg)
+		if err != nil {
+			return nil, err
+		}
+		return func(v tengo.Object) (tengo.Object, error) {
+			return path.get(v), nil
+		}, nil
+	}
+	fn, err := callableArg(arg, "key")
+	if err != nil {
+		return nil, err
+	}
+	return func(v tengo.Object) (tengo.Object, error) {
+		return s.call(fn, v)
+	}, nil
+}
+
+func queryArg(arg tengo.Object) (*queryPath, error) {
+	switch arg := arg.(type) {
+	case *queryObject:
+		return arg.path, nil
+	case *tengo.String:
+		return compileQuery(arg.Value)
+	}
+	return nil, tengo.ErrInvalidArgumentType{
+		Name:     "query",
+		Expected: "string|query",
+		Found:    arg.TypeName(),
+	}
+}
+
+func callableArg(arg tengo.Object, name string) (tengo.Object, error) {
+	if !arg.CanCall() {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     name,
+			Expected: "callable",
+			Found:    arg.TypeName(),
+		}
+	}
+	return arg, nil
+}
+
+func arrayArg(arg tengo.Object, name string) ([]tengo.Object, error) {
+	items, ok := arrayValue(arg)
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     name,
+			Expected: "array",
+			Found:    arg.TypeName(),
+		}
+	}
+	return items, nil
+}
+
+func arrayValue(v tengo.Object) ([]tengo.Object, bool) {
+	switch v := v.(type) {
+	case *tengo.Array:
+		return v.Value, true
+	case *tengo.ImmutableArray:
+		return v.Value, true
+	}
+	return nil, false
+}
+
+func mapValue(v tengo.Object) (map[string]tengo.Object, bool) {
+	switch v := v.(type) {
+	case *tengo.Map:
+		return v.Value, true
+	case *tengo.ImmutableMap:
+		return v.Value, true
+	}
+	return nil, false
+}
+
+// compileQuery parses expr or returns the cached result of a previous call
+func compileQuery(expr string) (*queryPath, error) {
+	v, err := cachedQuery(queryCacheKey{expr: expr}, func() (any, error) {
+		p := &queryParser{src: expr}
+		path, err := p.path(true)
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.eof() {
+			return nil, p.errorf("unexpected %q", p.src[p.pos:])
+		}
+		return path, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*queryPath), nil
+}
+
+func compileFilter(expr string) (queryFilter, error) {
+	v, err := cachedQuery(queryCacheKey{filter: true, expr: expr}, func() (any, error) {
+		p := &queryParser{src: expr}
+		filter, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.eof() {
+			return nil, p.errorf("unexpected %q", p.src[p.pos:])
+		}
+		return filter, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(queryFilter), nil
+}
+
+func cachedQuery(key queryCacheKey, compile func() (any, error)) (any, error) {
+	queryCache.Lock()
+	v, found := queryCache.items[key]
+	queryCache.Unlock()
+	if found {
+		return v, nil
+	}
+	v, err := compile()
+	if err != nil {
+		return nil, err
+	}
+	queryCache.Lock()
+	defer queryCache.Unlock()
+	if len(queryCache.items) >= maxCachedQueries {
+		queryCache.items = map[queryCacheKey]any{}
+	}
+	queryCache.items[key] = v
+	return v, nil
+}
+
+// definite reports whether the path selects at most one value
+func (q *queryPath) definite() bool {
+	for _, s := range q.steps {
+		if s.recursive {
+			return false
+		}
+		switch sel := s.sel.(type) {
+		case selectName:
+			if len(sel) != 1 {
+				return false
+			}
+		case selectIndex:
+			if len(sel) != 1 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (q *queryPath) eval(root, start tengo.Object) []tengo.Object {
+	nodes := []tengo.Object{start}
+	for _, step := range q.steps {
+		if step.recursive {
+			var all []tengo.Object
+			for _, n := range nodes {
+				all = descendants(n, all)
+			}
+			nodes = all
+		}
+		var next []tengo.Object
+		for _, n := range nodes {
+			next = step.sel.apply(root, n, next)
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// get returns the selected value for definite paths
+// and an array with every match otherwise
+func (q *queryPath) get(v tengo.Object) tengo.Object {
+	if q.definite() {
+		return q.first(v)
+	}
+	return &tengo.Array{Value: append([]tengo.Object{}, q.eval(v, v)...)}
+}
+
+func (q *queryPath) first(v tengo.Object) tengo.Object {
+	found := q.eval(v, v)
+	if len(found) == 0 {
+		return tengo.UndefinedValue
+	}
+	return found[0]
+}
+
+func (n selectName) apply(root, node tengo.Object, out []tengo.Object) []tengo.Object {
+	m, ok := mapValue(node)
+	if !ok {
+		return out
+	}
+	for _, name := range n {
+		if v, found := m[name]; found {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func (selectWildcard) apply(root, node tengo.Object, out []tengo.Object) []tengo.Object {
+	return children(node, out)
+}
+
+func (idx selectIndex) apply(root, node tengo.Object, out []tengo.Object) []tengo.Object {
+	items, ok := arrayValue(node)
+	if !ok {
+		return out
+	}
+	for _, i := range idx {
+		if i < 0 {
+			i += len(items)
+		}
+		if i >= 0 && i < len(items) {
+			out = append(out, items[i])
+		}
+	}
+	return out
+}
+
+func (s selectSlice) apply(root, node tengo.Object, out []tengo.Object) []tengo.Object {
+	items, ok := arrayValue(node)
+	if !ok {
+		return out
+	}
+	size := len(items)
+	bound := func(v *int, def int) int {
+		if v == nil {
+			return def
+		}
+		i := *v
+		if i < 0 {
+			i += size
+		}
+		return min(max(i, -1), size)
+	}
+	if s.step > 0 {
+		for i := max(bound(s.start, 0), 0); i < bound(s.end, size); i += s.step {
+			out = append(out, items[i])
+		}
+	} else {
+		for i := min(bound(s.start, size-1), size-1); i > bound(s.end, -1); i += s.step {
+			out = append(out, items[i])
+		}
+	}
+	return out
+}
+
+func (s selectFilter) apply(root, node tengo.Object, out []tengo.Object) []tengo.Object {
+	for _, c := range children(node, nil) {
+		if !s.filter.value(root, c).IsFalsy() {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// children appends the elements of arrays or the values of maps,
+// ordered by key so results are stable
+func children(node tengo.Object, out []tengo.Object) []tengo.Object {
+	if items, ok := arrayValue(node); ok {
+		return append(out, items...)
+	}
+	if m, ok := mapValue(node); ok {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			out = append(out, m[k])
+		}
+	}
+	return out
+}
+
+func descendants(node tengo.Object, out []tengo.Object) []tengo.Object {
+	out = append(out, node)
+	for _, c := range children(node, nil) {
+		out = descendants(c, out)
+	}
+	return out
+}
+
+func (f filterPath) value(root, cur tengo.Object) tengo.Object {
+	start := root
+	if f.relative {
+		start = cur
+	}
+	if f.path.definite() {
+		return f.path.first(start)
+	}
+	return &tengo.Array{Value: f.path.eval(root, start)}
+}
+
+func (f filterLiteral) value(root, cur tengo.Object) tengo.Object {
+	return f.v
+}
+
+func (f filterNot) value(root, cur tengo.Object) tengo.Object {
+	return boolObject(f.x.value(root, cur).IsFalsy())
+}
+
+func (f filterBinary) value(root, cur tengo.Object) tengo.Object {
+	l := f.l.value(root, cur)
+	switch f.op {
+	case "&&":
+		if l.IsFalsy() {
+			return tengo.FalseValue
+		}
+		return boolObject(!f.r.value(root, cur).IsFalsy())
+	case "||":
+		if !l.IsFalsy() {
+			return tengo.TrueValue
+		}
+		return boolObject(!f.r.value(root, cur).IsFalsy())
+	}
+	r := f.r.value(root, cur)
+	switch f.op {
+	case "==":
+		return boolObject(equalObjects(l, r))
+	case "!=":
+		return boolObject(!equalObjects(l, r))
+	case "=~":
+		str, ok := l.(*tengo.String)
+		return boolObject(ok && f.re.MatchString(str.Value))
+	}
+	c, ok := compareObjects(l, r)
+	if !ok {
+		return tengo.FalseValue
+	}
+	switch f.op {
+	case "<":
+		return boolObject(c < 0)
+	case "<=":
+		return boolObject(c <= 0)
+	case ">":
+		return boolObject(c > 0)
+	case ">=":
+		return boolObject(c >= 0)
+	}
+	return tengo.FalseValue
+}
+
+func equalObjects(a, b tengo.Object) bool {
+	if c, ok := compareObjects(a, b); ok {
+		return c == 0
+	}
+	return a.Equals(b)
+}
+
+// compareObjects orders numbers and strings, ok is false
+// when the values cannot be compared
+func compareObjects(a, b tengo.Object) (int, bool) {
+	if x, ok := numberValue(a); ok {
+		if y, ok := numberValue(b); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+		return 0, false
+	}
+	x, ok := a.(*tengo.String)
+	if !ok {
+		return 0, false
+	}
+	y, ok := b.(*tengo.String)
+	if !ok {
+		return 0, false
+	}
+	return strings.Compare(x.Value, y.Value), true
+}
+
+// orderObjects is a total order used for sorting, values that cannot
+// be compared are ordered by type and then by their string form
+func orderObjects(a, b tengo.Object) int {
+	if c, ok := compareObjects(a, b); ok {
+		return c
+	}
+	rank := func(v tengo.Object) int {
+		if _, ok := numberValue(v); ok {
+			return 0
+		}
+		switch v.(type) {
+		case *tengo.String:
+			return 1
+		case *tengo.Undefined:
+			return 3
+		}
+		return 2
+	}
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return ra - rb
+	}
+	return strings.Compare(a.String(), b.String())
+}
+
+func numberValue(v tengo.Object) (float64, bool) {
+	switch v := v.(type) {
+	case *tengo.Int:
+		return float64(v.Value), true
+	case *tengo.Float:
+		return v.Value, true
+	}
+	return 0, false
+}
+
+func (p *queryParser) path(implicitRoot bool) (*queryPath, error) {
+	start := p.pos
+	q := &queryPath{}
+	switch {
+	case p.consume("$"), p.consume("@"):
+	case implicitRoot && isNameChar(p.peek()):
+		name := p.name()
+		q.steps = append(q.steps, queryStep{sel: selectName{name}})
+	case implicitRoot && p.peek() == '[':
+	default:
+		return nil, p.errorf("expected $ or @")
+	}
+	for !p.eof() {
+		var step queryStep
+		switch {
+		case p.consume(".."):
+			step.recursive = true
+			if p.peek() == '[' {
+				sel, err := p.bracket()
+				if err != nil {
+					return nil, err
+				}
+				step.sel = sel
+			} else if p.consume("*") {
+				step.sel = selectWildcard{}
+			} else if name := p.name(); name != "" {
+				step.sel = selectName{name}
+			} else {
+				return nil, p.errorf("expected a name after ..")
+			}
+		case p.consume("."):
+			if p.consume("*") {
+				step.sel = selectWildcard{}
+			} else if name := p.name(); name != "" {
+				step.sel = selectName{name}
+			} else {
+				return nil, p.errorf("expected a name after .")
+			}
+		case p.peek() == '[':
+			sel, err := p.bracket()
+			if err != nil {
+				return nil, err
+			}
+			step.sel = sel
+		default:
+			q.expr = p.src[start:p.pos]
+			return q, nil
+		}
+		q.steps = append(q.steps, step)
+	}
+	q.expr = p.src[start:p.pos]
+	return q, nil
+}
+
+func (p *queryParser) bracket() (querySelector, error) {
+	p.consume("[")
+	p.skipSpace()
+	var sel querySelector
+	switch c := p.peek(); {
+	case c == '*':
+		p.pos++
+		sel = selectWildcard{}
+	case c == '?':
+		p.pos++
+		filter, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		sel = selectFilter{filter: filter}
+	case c == '\'' || c == '"':
+		var names selectName
+		for {
+			p.skipSpace()
+			str, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, str)
+			p.skipSpace()
+			if !p.consume(",") {
+				break
+			}
+		}
+		sel = names
+	default:
+		var err error
+		sel, err = p.indexes()
+		if err != nil {
+			return nil, err
+		}
+	}
+	p.skipSpace()
+	if !p.consume("]") {
+		return nil, p.errorf("expected ]")
+	}
+	return sel, nil
+}
+
+func (p *queryParser) indexes() (querySelector, error) {
+	first, err := p.optInt()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.peek() == ':' {
+		slice := selectSlice{start: first, step: 1}
+		p.pos++
+		p.skipSpace()
+		if slice.end, err = p.optInt(); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.consume(":") {
+			p.skipSpace()
+			step, err := p.optInt()
+			if err != nil {
+				return nil, err
+			}
+			if step != nil {
+				slice.step = *step
+			}
+		}
+		if slice.step == 0 {
+			return nil, p.errorf("slice step cannot be zero")
+		}
+		return slice, nil
+	}
+	if first == nil {
+		return nil, p.errorf("expected an index")
+	}
+	idx := selectIndex{*first}
+	for p.consume(",") {
+		p.skipSpace()
+		next, err := p.optInt()
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			return nil, p.errorf("expected an index")
+		}
+		idx = append(idx, *next)
+		p.skipSpace()
+	}
+	return idx, nil
+}
+
+func (p *queryParser) optInt() (*int, error) {
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	for isDigit(p.peek()) {
+		p.pos++
+	}
+	if start == p.pos {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(p.src[start:p.pos])
+	if err != nil {
+		return nil, p.errorf("invalid index %q", p.src[start:p.pos])
+	}
+	return &n, nil
+}
+
+func (p *queryParser) or() (queryFilter, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.skipSpace(); p.consume("||"); p.skipSpace() {
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l = filterBinary{op: "||", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *queryParser) and() (queryFilter, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.skipSpace(); p.consume("&&"); p.skipSpace() {
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l = filterBinary{op: "&&", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *queryParser) unary() (queryFilter, error) {
+	p.skipSpace()
+	if p.peek() == '!' && !strings.HasPrefix(p.src[p.pos:], "!=") {
+		p.pos++
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return filterNot{x: x}, nil
+	}
+	return p.comparison()
+}
+
+func (p *queryParser) comparison() (queryFilter, error) {
+	l, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	for _, op := range []string{"==", "!=", "<=", ">=", "=~", "<", ">"} {
+		if !p.consume(op) {
+			continue
+		}
+		p.skipSpace()
+		r, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		cmp := filterBinary{op: op, l: l, r: r}
+		if op == "=~" {
+			lit, ok := r.(filterLiteral)
+			str, isStr := lit.v.(*tengo.String)
+			if !ok || !isStr {
+				return nil, p.errorf("=~ expects a string literal")
+			}
+			if cmp.re, err = regexp.Compile(str.Value); err != nil {
+				return nil, err
+			}
+		}
+		return cmp, nil
+	}
+	return l, nil
+}
+
+func (p *queryParser) primary() (queryFilter, error) {
+	p.skipSpace()
+	switch c := p.peek(); {
+	case c == '(':
+		p.pos++
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consume(")") {
+			return nil, p.errorf("expected )")
+		}
+		return x, nil
+	case c == '@' || c == '$':
+		path, err := p.path(false)
+		if err != nil {
+			return nil, err
+		}
+		return filterPath{relative: c == '@', path: path}, nil
+	case c == '\'' || c == '"':
+		str, err := p.str()
+		if err != nil {
+			return nil, err
+		}
+		return filterLiteral{v: &tengo.String{Value: str}}, nil
+	case c == '-' || isDigit(c):
+		start := p.pos
+		p.pos++
+		for isDigit(p.peek()) || strings.IndexByte(".eE+-", p.peek()) >= 0 && p.peek() != 0 {
+			p.pos++
+		}
+		text := p.src[start:p.pos]
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return filterLiteral{v: &tengo.Int{Value: n}}, nil
+		}
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", text)
+		}
+		return filterLiteral{v: &tengo.Float{Value: f}}, nil
+	}
+	switch name := p.name(); name {
+	case "true":
+		return filterLiteral{v: tengo.TrueValue}, nil
+	case "false":
+		return filterLiteral{v: tengo.FalseValue}, nil
+	case "null", "undefined":
+		return filterLiteral{v: tengo.UndefinedValue}, nil
+	}
+	return nil, p.errorf("expected a value")
+}
+
+func (p *queryParser) str() (string, error) {
+	quote := p.peek()
+	if quote != '\'' && quote != '"' {
+		return "", p.errorf("expected a string")
+	}
+	p.pos++
+	var sb strings.Builder
+	for !p.eof() {
+		c := p.src[p.pos]
+		p.pos++
+		switch {
+		case c == quote:
+			return sb.String(), nil
+		case c == '\\' && !p.eof():
+			sb.WriteByte(p.src[p.pos])
+			p.pos++
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *queryParser) name() string {
+	start := p.pos
+	for isNameChar(p.peek()) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *queryParser) skipSpace() {
+	for !p.eof() && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *queryParser) consume(tok string) bool {
+	if strings.HasPrefix(p.src[p.pos:], tok) {
+		p.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *queryParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *queryParser) errorf(msg string, args ...any) error {
+	return fmt.Errorf("query %q at %v: %v", p.src, p.pos, fmt.Sprintf(msg, args...))
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (o *queryObject) TypeName() string { return "query" }
+func (o *queryObject) String() string   { return fmt.Sprintf("<query %v>", o.path.expr) }
+func (o *queryObject) CanCall() bool    { return true }
+
+func (o *queryObject) Call(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	return o.path.get(args[0]), nil
+}
+
+func (o *queryObject) IndexGet(index tengo.Object) (tengo.Object, error) {
+	key, _ := tengo.ToString(index)
+	switch key {
+	case "expr":
+		return &tengo.String{Value: o.path.expr}, nil
+	case "get":
+		return &tengo.UserFunction{Name: "get", Value: o.Call}, nil
+	case "first":
+		return &tengo.UserFunction{
+			Name: "first",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 1 {
+					return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+				}
+				return o.path.first(args[0]), nil
+			},
+		}, nil
+	}
+	return tengo.UndefinedValue, nil
+}
+
+func boolObject(b bool) tengo.Object {
+	if b {
+		return tengo.TrueValue
+	}
+	return tengo.FalseValue
+}
@@ -0,0 +1,141 @@
+package shell
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/d5/tengo/v2"
+)
+
+const queryDoc = `{
+	"store": {
+		"book": [
+			{"title": "a", "price": 8, "tags": ["new"]},
+			{"title": "b", "price": 12, "tags": []},
+			{"title": "c", "price": 22.5, "isbn": "x-1"}
+		],
+		"bicycle": {"price": 19, "color": "red"}
+	},
+	"odd key": 1
+}`
+
+func TestQueryPath(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(queryDoc), &doc); err != nil {
+		t.Fatal(err)
+	}
+	root, err := tengo.FromInterface(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"$", queryDoc},
+		{"$.store.bicycle.color", `"red"`},
+		{"store.bicycle.color", `"red"`},
+		{"$['odd key']", `1`},
+		{`$["store"]['bicycle']["price"]`, `19`},
+		{"$.missing", `null`},
+		{"$.store.book[0].title", `"a"`},
+		{"$.store.book[-1].title", `"c"`},
+		{"$.store.book[5]", `null`},
+		{"$.store.book[*].title", `["a", "b", "c"]`},
+		{"$.store.book.*.title", `["a", "b", "c"]`},
+		{"$.store.book[0, 2].title", `["a", "c"]`},
+		{"$.store.book[1:].title", `["b", "c"]`},
+		{"$.store.book[:-1].title", `["a", "b"]`},
+		{"$.store.book[::-1].title", `["c", "b", "a"]`},
+		{"$.store.book[::2].title", `["a", "c"]`},
+		{"$.store.book[10:]", `[]`},
+		{"$.store.bicycle[*]", `["red", 19]`},
+		{"$..price", `[19, 8, 12, 22.5]`},
+		{"$..book[0].title", `["a"]`},
+		{"$.store.book[?(@.price > 10)].title", `["b", "c"]`},
+		{"$.store.book[?(@.price >= 8 && @.price < 20)].title", `["a", "b"]`},
+		{"$.store.book[?(@.isbn)].title", `["c"]`},
+		{"$.store.book[?(!@.isbn)].title", `["a", "b"]`},
+		{"$.store.book[?(@.title == 'b' || @.title == \"c\")].price", `[12, 22.5]`},
+		{"$.store.book[?(@.title != 'b')].title", `["a", "c"]`},
+		{"$.store.book[?(@.title =~ '^[ab]$')].title", `["a", "b"]`},
+		{"$.store.book[?(@.tags[0] == 'new')].title", `["a"]`},
+		{"$.store.book[?(@.price < $.store.bicycle.price)].title", `["a", "b"]`},
+		{"$.store.book[?(@.price == 22.5)].title", `["c"]`},
+		{"$.store.book[?(@.price > 'x')].title", `[]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			q, err := compileQuery(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(tengo.ToInterface(q.get(root)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want any
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			wantBuf, _ := json.Marshal(want)
+			if string(got) != string(wantBuf) {
+				t.Fatalf("expected %s, got %s", wantBuf, got)
+			}
+		})
+	}
+}
+
+func TestQueryParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"$.",
+		"$..",
+		"$[",
+		"$[0",
+		"$['a'",
+		"$['a",
+		"$[::0]",
+		"$[a]",
+		"$[0,]",
+		"$[?(@.a ==)]",
+		"$[?(@.a =~ @.b)]",
+		"$[?(@.a =~ '(')]",
+		"$[?(@.a > 1]",
+		"$.a b",
+		"#",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := compileQuery(expr); err == nil {
+				t.Fatalf("%q should not compile", expr)
+			}
+		})
+	}
+}
+
+func TestQueryModule(t *testing.T) {
+	const items = `items := [{id: 1, kind: "a", n: 3}, {id: 2, kind: "b", n: 1}, {id: 3, kind: "a", n: 2}]`
+	runScripts(t, nil, "query := import(\"query\")\n"+items, []scriptTest{
+		{"get", `query.get({a: {b: [1, 2]}}, "$.a.b[1]")`, "2", false},
+		{"get many", `query.get(items, "$[*].id")`, "[1, 2, 3]", false},
+		{"get invalid", `query.get(items, "$[")`, "", true},
+		{"first", `query.first(items, "$[?(@.kind == 'a')].id")`, "1", false},
+		{"first missing", `is_undefined(query.first(items, "$[?(@.kind == 'c')]"))`, "true", false},
+		{"compile", `q := query.compile("$[*].n"); [q(items), q.get(items), q.first(items), q.expr]`, `[[3, 1, 2], [3, 1, 2], 3, "$[*].n"]`, false},
+		{"compiled as argument", `query.get(items, query.compile("$[0].id"))`, "1", false},
+		{"select filter", `query.map(query.select(items, "@.n >= 2"), "id")`, "[1, 3]", false},
+		{"select func", `query.map(query.select(items, func(v) { return v.kind == "b" }), "id")`, "[2]", false},
+		{"select invalid filter", `query.select(items, "@.n >=")`, "", true},
+		{"select not an array", `query.select(1, "@")`, "", true},
+		{"map func", `query.map(items, func(v) { return v.n * 2 })`, "[6, 2, 4]", false},
+		{"group_by", `g := query.group_by(items, "kind"); [len(g.a), len(g.b), g.a[1].id]`, "[2, 1, 3]", false},
+		{"sort_by", `query.map(query.sort_by(items, "n"), "id")`, "[2, 3, 1]", false},
+		{"sort_by desc", `query.map(query.sort_by(items, func(v) { return v.n }, true), "id")`, "[1, 3, 2]", false},
+		{"sort_by is stable", `query.map(query.sort_by(items, "kind"), "id")`, "[1, 3, 2]", false},
+		{"sort_by leaves input", `query.sort_by(items, "n"); query.map(items, "id")`, "[1, 2, 3]", false},
+		{"flatten", `query.flatten([1, [2, [3, [4]]]])`, "[1, 2, [3, [4]]]", false},
+		{"flatten depth", `query.flatten([1, [2, [3, [4]]]], 2)`, "[1, 2, 3, [4]]", false},
+		{"flatten all", `query.flatten([1, [2, [3, [4]]]], -1)`, "[1, 2, 3, 4]", false},
+		{"flatten bad depth", `query.flatten([], "x")`, "", true},
+	})
+}
@@ -0,0 +1,255 @@
+package shell
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/d5/tengo/v2"
+)
+
+type (
+	// RedactionRules decide what is hidden before history, snapshots,
+	// job transcripts and logs are persisted
+	RedactionRules struct {
+		// Patterns are regular expressions, when they have groups
+		// only the first group is redacted
+		Patterns []string `json:"patterns"`
+		// Secrets lists the vault entries whose values are redacted,
+		// "*" redacts all of them
+		Secrets []string `json:"secrets"`
+		// Variables are marked sensitive from the start
+		Variables []string `json:"variables"`
+	}
+
+	redactor struct {
+		mu       sync.Mutex
+		rules    RedactionRules
+		patterns []*regexp.Regexp
+		// variables marked sensitive and their last string value
+		variables map[string]string
+	}
+)
+
+const (
+	// RedactionMarker replaces text matched by a pattern,
+	// secrets and variables also include their name
+	RedactionMarker = "[redacted]"
+
+	// values shorter than this would hide too much unrelated text
+	minRedactedLen = 4
+)
+
+// SetRedaction replaces the redaction rules, variables marked
+// sensitive by scripts are kept
+func (s *Shell) SetRedaction(rules RedactionRules) error {
+	patterns := make([]*regexp.Regexp, 0, len(rules.Patterns))
+	for _, p := range rules.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("redact: invalid pattern %q: %w", p, err)
+		}
+		patterns = append(patterns, re)
+	}
+	s.redaction.mu.Lock()
+	defer s.redaction.mu.Unlock()
+	s.redaction.rules = rules
+	s.redaction.patterns = patterns
+	for _, v := range rules.Variables {
+		s.redaction.mark(v)
+	}
+	return nil
+}
+
+// Redact hides the secrets, sensitive variables and
+// text matching the redaction patterns
+func (s *Shell) Redact(text string) string {
+	type literal struct{ name, value string }
+	var literals []literal
+	s.redaction.mu.Lock()
+	secrets := s.redaction.rules.Secrets
+	for name, value := range s.redaction.variables {
+		literals = append(literals, literal{name, value})
+	}
+	patterns := s.redaction.patterns
+	s.redaction.mu.Unlock()
+
+	s.vault.mu.Lock()
+	for _, name := range secrets {
+		if name == "*" {
+			for name, value := range s.vault.values {
+				literals = append(literals, literal{name, value})
+			}
+		} else if value, found := s.vault.values[name]; found {
+			literals = append(literals, literal{name, value})
+		}
+	}
+	s.vault.mu.Unlock()
+
+	// longer values first, so a value containing
+	// another is not left partially visible
+	sort.Slice(literals, func(i, j int) bool { return len(literals[i].value) > len(literals[j].value) })
+	for _, l := range literals {
+		if len(l.value) < minRedactedLen {
+			continue
+		}
+		text = strings.ReplaceAll(text, l.value, fmt.Sprintf("[redacted:%v]", l.name))
+	}
+	for _, re := range patterns {
+		text = redactPattern(re, text)
+	}
+	return text
+}
+
+func (s *Shell) redactModule() map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"variable": &tengo.UserFunction{
+			Name: "variable",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) == 0 {
+					return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+				}
+				s.redaction.mu.Lock()
+				defer s.redaction.mu.Unlock()
+				for _, a := range args {
+					name, ok := a.(*tengo.String)
+					if !ok {
+						return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+							Name:     "name",
+							Expected: "string",
+							Found:    a.TypeName(),
+						}
+					}
+					s.redaction.mark(name.Value)
+				}
+				return tengo.UndefinedValue, nil
+			},
+		},
+		"text": &tengo.UserFunction{
+			Name: "text",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 1 {
+					return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+				}
+				text, ok := tengo.ToString(args[0])
+				if !ok {
+					return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+						Name:     "text",
+						Expected: "string",
+						Found:    args[0].TypeName(),
+					}
+				}
+				s.captureSensitive()
+				return &tengo.String{Value: s.Redact(text)}, nil
+			},
+		},
+	}
+}
+
+// captureSensitive remembers the current value of the sensitive
+// variables, so it can be redacted later. It must be called
+// with the session lock held, ie.: from module functions
+func (s *Shell) captureSensitive() {
+	s.redaction.mu.Lock()
+	defer s.redaction.mu.Unlock()
+	for name := range s.redaction.variables {
+		symbol, _, found := s.repl.symbols.Resolve(name, false)
+		if !found || symbol.Scope != tengo.ScopeGlobal {
+			continue
+		}
+		switch v := s.repl.globals[symbol.Index].(type) {
+		case *tengo.String:
+			s.redaction.variables[name] = v.Value
+		case *secretObject:
+			s.redaction.variables[name] = v.value
+		}
+	}
+}
+
+// redactItems prepares the values of a snapshot, sensitive variables
+// are replaced by the marker. It returns the variables which changed
+func (s *Shell) redactItems(items map[string]any) map[string]struct{} {
+	s.redaction.mu.Lock()
+	sensitive := make(map[string]bool, len(s.redaction.variables))
+	for name := range s.redaction.variables {
+		sensitive[name] = true
+	}
+	s.redaction.mu.Unlock()
+	redacted := map[string]struct{}{}
+	for k, v := range items {
+		if sensitive[k] {
+			items[k] = RedactionMarker
+			redacted[k] = struct{}{}
+			continue
+		}
+		items[k] = s.redactValue(v)
+		if !reflect.DeepEqual(v, items[k]) {
+			redacted[k] = struct{}{}
+		}
+	}
+	return redacted
+}
+
+// redactValue applies Redact to every string inside v
+func (s *Shell) redactValue(v any) any {
+	switch v := v.(type) {
+	case string:
+		return s.Redact(v)
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = s.redactValue(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = s.redactValue(item)
+		}
+		return out
+	}
+	return v
+}
+
+// reset forgets the variables marked by scripts,
+// keeping the ones from the rules
+func (r *redactor) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.variables = nil
+	for _, v := range r.rules.Variables {
+		r.mark(v)
+	}
+}
+
+// mark must be called with the lock held
+func (r *redactor) mark(name string) {
+	if r.variables == nil {
+		r.variables = map[string]string{}
+	}
+	if _, found := r.variables[name]; !found {
+		r.variables[name] = ""
+	}
+}
+
+func redactPattern(re *regexp.Regexp, text string) string {
+	if re.NumSubexp() == 0 {
+		return re.ReplaceAllLiteralString(text, RedactionMarker)
+	}
+	var sb strings.Builder
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(text, -1) {
+		start, end := m[2], m[3]
+		if start < 0 {
+			continue
+		}
+		sb.WriteString(text[last:start])
+		sb.WriteString(RedactionMarker)
+		last = end
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
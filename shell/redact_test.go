@@ -0,0 +1,147 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules RedactionRules
+		text  string
+		want  string
+	}{
+		{"no rules", RedactionRules{}, "token hunter2", "token hunter2"},
+		{"all secrets", RedactionRules{Secrets: []string{"*"}}, "token hunter2", "token [redacted:token]"},
+		{"named secret", RedactionRules{Secrets: []string{"token"}}, "hunter2 pin1234", "[redacted:token] pin1234"},
+		{"other secret", RedactionRules{Secrets: []string{"pin"}}, "hunter2 pin1234", "hunter2 [redacted:pin]"},
+		{"pattern", RedactionRules{Patterns: []string{`\d{3}-\d{4}`}}, "call 555-1234", "call [redacted]"},
+		{"pattern group", RedactionRules{Patterns: []string{`password=(\w+)`}}, "password=abc&x=1", "password=[redacted]&x=1"},
+		{"longest first", RedactionRules{Secrets: []string{"*"}}, "pin1234-extra", "[redacted:long]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestShell(t)
+			s.EnableSecrets()
+			if err := s.UnlockSecrets("passphrase"); err != nil {
+				t.Fatal(err)
+			}
+			s.SetSecret("token", "hunter2")
+			s.SetSecret("pin", "pin1234")
+			s.SetSecret("long", "pin1234-extra")
+			s.SetSecret("short", "ab")
+			if err := s.SetRedaction(tt.rules); err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Redact(tt.text); got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRedactInvalidPattern(t *testing.T) {
+	s := newTestShell(t)
+	if err := s.SetRedaction(RedactionRules{Patterns: []string{"("}}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestRedactedSnapshotRestore(t *testing.T) {
+	s := newTestShell(t)
+	if err := s.SetRedaction(RedactionRules{Patterns: []string{`tok\w+`}}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := eval(t, s, `
+redact := import("redact")
+phrase := "token is a word"
+plain := "nothing to hide"
+nested := {list: ["a", "tokxyz"]}
+apiKey := "abcdef"
+redact.variable("apiKey")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := s.Snapshot(context.Background(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "token") || strings.Contains(buf.String(), "abcdef") {
+		t.Fatalf("snapshot was not redacted: %v", buf.String())
+	}
+	var saved snapshotFormat
+	if err := json.Unmarshal(buf.Bytes(), &saved); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"phrase", "nested", "apiKey"} {
+		if _, found := saved.Redacted[k]; !found {
+			t.Errorf("%v should be listed as redacted", k)
+		}
+	}
+	if _, found := saved.Redacted["plain"]; found {
+		t.Error("plain should not be listed as redacted")
+	}
+
+	restored := newTestShell(t)
+	var stderr bytes.Buffer
+	restored.SetOutput(&bytes.Buffer{}, &stderr)
+	if err := restored.RestoreSnapshot(context.Background(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := restored.Snapshot(context.Background(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	var after snapshotFormat
+	if err := json.Unmarshal(buf.Bytes(), &after); err != nil {
+		t.Fatal(err)
+	}
+	if len(after.Data) != 1 || string(after.Data["plain"]) != `"nothing to hide"` {
+		t.Fatalf("redacted values were restored: %v", buf.String())
+	}
+	if !strings.Contains(stderr.String(), "phrase was redacted") {
+		t.Fatalf("missing warning: %q", stderr.String())
+	}
+}
+
+func TestRedactLog(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		fail bool
+	}{
+		{"message", `log.info("key is " + apiKey)`, false},
+		{"pairs", `log.info("login", "key", apiKey, "n", 1)`, false},
+		{"attrs", `log.warn("login", {key: apiKey, nested: [apiKey]})`, false},
+		{"invalid message", `log.info(undefined, apiKey)`, true},
+		{"odd pairs", `log.info("login", "key")`, true},
+		{"invalid key", `log.info("login", undefined, apiKey)`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestShell(t)
+			var logs bytes.Buffer
+			s.SetLogHandler(slog.NewJSONHandler(&logs, nil))
+			_, err := eval(t, s, `
+log := import("log")
+redact := import("redact")
+apiKey := "abcdef"
+redact.variable("apiKey")
+`+tt.code)
+			if tt.fail != (err != nil) {
+				t.Fatalf("unexpected result: %v", err)
+			}
+			if strings.Contains(logs.String(), "abcdef") {
+				t.Fatalf("log was not redacted: %v", logs.String())
+			}
+			if !tt.fail && !strings.Contains(logs.String(), "[redacted:apiKey]") {
+				t.Fatalf("missing marker: %v", logs.String())
+			}
+		})
+	}
+}
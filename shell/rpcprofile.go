@@ -0,0 +1,98 @@
+package shell
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/d5/tengo/v2"
+)
+
+type (
+	// rpcProfiles keeps the headers configured with jsonrpc.profile,
+	// they are added to every request sent to the endpoint
+	rpcProfiles struct {
+		mu        sync.Mutex
+		endpoints map[string]map[string]tengo.Object
+	}
+)
+
+// jsonrpcProfile implements profile(endpoint, opts), opts accepts
+// headers (map of strings or secrets), undefined removes the profile
+func (s *Shell) jsonrpcProfile(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 2 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	endpoint, ok := tengo.ToString(args[0])
+	if !ok {
+		return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+			Name:     "endpoint",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+	}
+	if args[1] == tengo.UndefinedValue {
+		s.rpcProfiles.set(endpoint, nil)
+		return tengo.UndefinedValue, nil
+	}
+	opts, ok := mapValue(args[1])
+	if !ok {
+		return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+			Name:     "opts",
+			Expected: "map",
+			Found:    args[1].TypeName(),
+		}
+	}
+	headers := map[string]tengo.Object{}
+	if v, found := opts["headers"]; found {
+		m, ok := mapValue(v)
+		if !ok {
+			return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+				Name:     "headers",
+				Expected: "map",
+				Found:    v.TypeName(),
+			}
+		}
+		for k, v := range m {
+			switch v.(type) {
+			case *tengo.String, *secretObject:
+				headers[k] = v
+			default:
+				return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+					Name:     "headers." + k,
+					Expected: "string|secret",
+					Found:    v.TypeName(),
+				}
+			}
+		}
+	}
+	s.rpcProfiles.set(endpoint, headers)
+	return tengo.UndefinedValue, nil
+}
+
+func (r *rpcProfiles) set(endpoint string, headers map[string]tengo.Object) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if headers == nil {
+		delete(r.endpoints, endpoint)
+		return
+	}
+	if r.endpoints == nil {
+		r.endpoints = map[string]map[string]tengo.Object{}
+	}
+	r.endpoints[endpoint] = headers
+}
+
+// apply adds the headers of the endpoint profile to req
+func (r *rpcProfiles) apply(endpoint string, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, v := range r.endpoints[endpoint] {
+		req.Header.Set(k, secretValue(v))
+	}
+}
+
+func (r *rpcProfiles) clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.endpoints = nil
+}
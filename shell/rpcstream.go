@@ -0,0 +1,326 @@
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/d5/tengo/v2"
+)
+
+type (
+	// rpcStream reads items from a streaming json-rpc response,
+	// next returns io.EOF once the stream is exhausted
+	rpcStream struct {
+		body io.ReadCloser
+		next func() (any, error)
+
+		mu       sync.Mutex
+		closed   bool
+		iterated bool
+		untrack  func()
+		cancel   context.CancelFunc
+	}
+
+	// rpcStreamObject is returned by jsonrpc.stream when no callback
+	// is given, it can be used in a for ... in loop
+	rpcStreamObject struct {
+		tengo.ObjectImpl
+		stream *rpcStream
+	}
+
+	rpcStreamIterator struct {
+		tengo.ObjectImpl
+		stream *rpcStream
+		idx    int
+		value  tengo.Object
+		done   bool
+	}
+)
+
+func (s *Shell) jsonrpcStream(nextID func() string) tengo.CallableFunc {
+	return func(args ...tengo.Object) (tengo.Object, error) {
+		if len(args) != 3 && len(args) != 4 {
+			return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+		}
+		var fn tengo.Object
+		if len(args) == 4 {
+			fn = args[3]
+			if !fn.CanCall() {
+				return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+					Name:     "fn",
+					Expected: "callable",
+					Found:    fn.TypeName(),
+				}
+			}
+		}
+		endpoint, jreq, err := jsonrpcRequest(nextID(), args[:3]...)
+		if err != nil {
+			return tengo.UndefinedValue, err
+		}
+		if err := s.checkRPCParams(endpoint, jreq); err != nil {
+			return tengo.UndefinedValue, err
+		}
+		// the stream outlives the evaluation which opened it, so it can be
+		// iterated by a later command, cancelling the evaluation only
+		// aborts the request while waiting for the response
+		ctx, cancel := context.WithCancel(context.WithoutCancel(s.ctx))
+		stop := context.AfterFunc(s.ctx, cancel)
+		res, err := s.jsonrpcPost(ctx, endpoint, jreq, "text/event-stream, application/x-ndjson, application/json")
+		if !stop() {
+			err = s.ctx.Err()
+		}
+		if err != nil {
+			if res != nil {
+				res.Body.Close()
+			}
+			cancel()
+			return tengo.UndefinedValue, err
+		}
+		if res.StatusCode != 200 {
+			res.Body.Close()
+			cancel()
+			return tengo.UndefinedValue, fmt.Errorf("[json-rpc-error: %v] unexpected status code from server: %v", internalRPCErrorCode, res.StatusCode)
+		}
+		stream := s.trackRPCStream(newRPCStream(res), cancel)
+		if fn == nil {
+			return &rpcStreamObject{stream: stream}, nil
+		}
+		// callbacks consume the stream before the evaluation returns
+		defer context.AfterFunc(s.ctx, func() { stream.Close() })()
+		defer stream.Close()
+		for {
+			item, err := stream.next()
+			if err == io.EOF {
+				return tengo.UndefinedValue, nil
+			} else if err != nil {
+				return tengo.UndefinedValue, err
+			}
+			obj, err := tengo.FromInterface(item)
+			if err != nil {
+				return tengo.UndefinedValue, err
+			}
+			ret, err := s.call(fn, obj)
+			if err != nil {
+				return tengo.UndefinedValue, err
+			}
+			if ret == tengo.FalseValue {
+				// callback asked to stop
+				return tengo.UndefinedValue, nil
+			}
+		}
+	}
+}
+
+// trackRPCStream closes the body of stream once the session is reset
+// or closed, scripts might stop iterating before the end of the
+// stream or never iterate at all
+func (s *Shell) trackRPCStream(stream *rpcStream, cancel context.CancelFunc) *rpcStream {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	stream.cancel = cancel
+	stream.untrack = s.resources.track(stream)
+	return stream
+}
+
+// Close releases the body, it is safe to call more than once
+func (st *rpcStream) Close() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.closed {
+		return nil
+	}
+	st.closed = true
+	if st.untrack != nil {
+		st.untrack()
+		st.cancel()
+	}
+	return st.body.Close()
+}
+
+// consume marks the stream as iterated, it returns false if the
+// stream was already iterated or closed
+func (st *rpcStream) consume() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.closed || st.iterated {
+		return false
+	}
+	st.iterated = true
+	return true
+}
+
+func (st *rpcStream) consumed() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.closed || st.iterated
+}
+
+func newRPCStream(res *http.Response) *rpcStream {
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	stream := &rpcStream{body: res.Body}
+	switch mediaType {
+	case "text/event-stream":
+		stream.next = sseReader(res.Body)
+	case "application/x-ndjson", "application/jsonl", "application/jsonlines", "application/json-lines":
+		dec := json.NewDecoder(res.Body)
+		stream.next = func() (any, error) {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return nil, err
+			}
+			return decodeStreamItem(raw)
+		}
+	default:
+		// plain json-rpc reply, arrays are streamed item by item
+		stream.next = plainReader(res.Body)
+	}
+	return stream
+}
+
+func sseReader(body io.Reader) func() (any, error) {
+	rd := bufio.NewReader(body)
+	return func() (any, error) {
+		var data bytes.Buffer
+		var event string
+		for {
+			line, err := rd.ReadString('\n')
+			if err != nil && (err != io.EOF || line == "") {
+				if err == io.EOF && data.Len() > 0 {
+					// last event was not terminated by an empty line
+					break
+				}
+				return nil, err
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if line == "" {
+				if data.Len() == 0 {
+					continue
+				}
+				break
+			}
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "data":
+				if data.Len() > 0 {
+					data.WriteByte('\n')
+				}
+				data.WriteString(value)
+			case "event":
+				event = value
+			}
+		}
+		if data.String() == "[DONE]" {
+			return nil, io.EOF
+		}
+		if event == "error" {
+			return nil, fmt.Errorf("[json-rpc-error: %v] %v", internalRPCErrorCode, data.String())
+		}
+		return decodeStreamItem(data.Bytes())
+	}
+}
+
+func plainReader(body io.Reader) func() (any, error) {
+	var items []any
+	read := false
+	return func() (any, error) {
+		if !read {
+			read = true
+			var raw json.RawMessage
+			if err := json.NewDecoder(body).Decode(&raw); err != nil {
+				return nil, fmt.Errorf("[json-rpc-error: %v] decoding error: %v", internalRPCErrorCode, err)
+			}
+			item, err := decodeStreamItem(raw)
+			if err != nil {
+				return nil, err
+			}
+			if arr, ok := item.([]any); ok {
+				items = arr
+			} else {
+				items = []any{item}
+			}
+		}
+		if len(items) == 0 {
+			return nil, io.EOF
+		}
+		item := items[0]
+		items = items[1:]
+		return item, nil
+	}
+}
+
+// decodeStreamItem unwraps json-rpc replies, any other value is
+// returned as is
+func decodeStreamItem(raw []byte) (any, error) {
+	var envelope map[string]json.RawMessage
+	if json.Unmarshal(raw, &envelope) == nil && envelope["jsonrpc"] != nil {
+		var reply jsonRPCReply
+		if err := json.Unmarshal(raw, &reply); err != nil {
+			return nil, fmt.Errorf("[json-rpc-error: %v] decoding error: %v", internalRPCErrorCode, err)
+		}
+		if reply.Error.Code != 0 {
+			return nil, fmt.Errorf("[json-rpc-error: %v] %v", reply.Error.Code, reply.Error.Message)
+		} else if reply.Result == nil {
+			return nil, fmt.Errorf("[json-rpc-error: %v] %v", internalRPCErrorCode, "empty result")
+		}
+		raw = *reply.Result
+	}
+	var out any
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("[json-rpc-error: %v] decoding error: %v", internalRPCErrorCode, err)
+	}
+	return out, nil
+}
+
+// TypeName tells consumed streams apart, tengo reports them as
+// "not iterable: consumed-jsonrpc-stream" when used in a second loop
+func (o *rpcStreamObject) TypeName() string {
+	if o.stream.consumed() {
+		return "consumed-jsonrpc-stream"
+	}
+	return "jsonrpc-stream"
+}
+func (o *rpcStreamObject) String() string   { return "<" + o.TypeName() + ">" }
+func (o *rpcStreamObject) CanIterate() bool { return !o.stream.consumed() }
+func (o *rpcStreamObject) Iterate() tengo.Iterator {
+	it := &rpcStreamIterator{stream: o.stream}
+	it.done = !o.stream.consume()
+	return it
+}
+
+func (i *rpcStreamIterator) TypeName() string         { return "jsonrpc-stream-iterator" }
+func (i *rpcStreamIterator) String() string           { return "<jsonrpc-stream-iterator>" }
+func (i *rpcStreamIterator) Key() tengo.Object        { return &tengo.Int{Value: int64(i.idx - 1)} }
+func (i *rpcStreamIterator) Value() tengo.Object      { return i.value }
+func (i *rpcStreamIterator) Equals(tengo.Object) bool { return false }
+func (i *rpcStreamIterator) Copy() tengo.Object       { return i }
+
+// Next reads the next item from the stream, errors are returned
+// as the last value of the iteration
+func (i *rpcStreamIterator) Next() bool {
+	if i.done {
+		return false
+	}
+	item, err := i.stream.next()
+	if err == nil {
+		i.value, err = tengo.FromInterface(item)
+	}
+	if err != nil {
+		i.done = true
+		i.stream.Close()
+		if err == io.EOF {
+			return false
+		}
+		i.value = &tengo.Error{Value: &tengo.String{Value: err.Error()}}
+	}
+	i.idx++
+	return true
+}
@@ -0,0 +1,115 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRPCStreamClosed(t *testing.T) {
+	tests := []struct {
+		name  string
+		code  string
+		out   string
+		after func(s *Shell, cancel context.CancelFunc) error
+	}{
+		{
+			name:  "not iterated, reset",
+			code:  `st := jsonrpc.stream(url, "count", {})`,
+			after: func(s *Shell, _ context.CancelFunc) error { return s.Reset(context.Background()) },
+		},
+		{
+			name:  "break, close",
+			code:  `first := undefined; for v in jsonrpc.stream(url, "count", {}) { first = v; break }; fmt.println(first)`,
+			out:   "0",
+			after: func(s *Shell, _ context.CancelFunc) error { return s.Close() },
+		},
+		{
+			name:  "consumed, reset",
+			code:  `st := jsonrpc.stream(url, "count", {}); for v in st { break }`,
+			after: func(s *Shell, cancel context.CancelFunc) error { cancel(); return s.Reset(context.Background()) },
+		},
+		{
+			name:  "callback stops",
+			code:  `jsonrpc.stream(url, "count", {}, func(v) { return v < 2 })`,
+			after: func(*Shell, context.CancelFunc) error { return nil },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gone := make(chan struct{})
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer close(gone)
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				for i := 0; ; i++ {
+					fmt.Fprintf(w, "%d\n", i)
+					w.(http.Flusher).Flush()
+					select {
+					case <-r.Context().Done():
+						return
+					case <-time.After(10 * time.Millisecond):
+					}
+				}
+			}))
+			defer srv.Close()
+
+			s := newTestShell(t)
+			s.EnableJSONRPCClient()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var out bytes.Buffer
+			code := fmt.Sprintf("fmt := import(%q); jsonrpc := import(%q); url := %q\n%v", "fmt", "jsonrpc", srv.URL, tt.code)
+			if err := s.Eval(ctx, &out, &out, code, nil); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(strings.TrimSpace(out.String()), tt.out) {
+				t.Errorf("got %q, want %q", out.String(), tt.out)
+			}
+			if err := tt.after(s, cancel); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-gone:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the stream was never closed")
+			}
+		})
+	}
+}
+
+func TestRPCStreamLaterEval(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for i := 0; i < 5; i++ {
+			fmt.Fprintf(w, "%d\n", i)
+			w.(http.Flusher).Flush()
+			time.Sleep(10 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	s := newTestShell(t)
+	s.EnableJSONRPCClient()
+	// eval cancels the context of each command once it returns, as
+	// the gui does
+	code := fmt.Sprintf("jsonrpc := import(%q); st := jsonrpc.stream(%q, \"count\", {})", "jsonrpc", srv.URL)
+	if _, err := eval(t, s, code); err != nil {
+		t.Fatal(err)
+	}
+	out, err := eval(t, s, `sum := 0; for v in st { sum += v }; sum`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lastLine(out); got != "10" {
+		t.Errorf("got %q, want 10", got)
+	}
+	out, err = eval(t, s, `for v in st { }`)
+	if err == nil || !strings.Contains(err.Error(), "not iterable: consumed-jsonrpc-stream") {
+		t.Errorf("second iteration: got error %v, output %q", err, out)
+	}
+}
@@ -3,6 +3,7 @@ package shell
 import (
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/d5/tengo/v2"
 )
@@ -19,15 +20,36 @@ var (
 	}
 )
 
-func safeFmt(out io.Writer) map[string]tengo.Object {
+type (
+	// Prompter can be implemented by the reader given to Eval,
+	// to answer input requests interactively (eg.: using a dialog)
+	Prompter interface {
+		Prompt(prompt string) (string, error)
+	}
+)
+
+func safeFmt(out, errOut io.Writer, in io.Reader) map[string]tengo.Object {
 	if out == nil {
 		out = io.Discard
 	}
+	if errOut == nil {
+		errOut = io.Discard
+	}
+	if in == nil {
+		in = emptyBuffer{}
+	}
 	return map[string]tengo.Object{
 		"print":   &tengo.UserFunction{Name: "print", Value: fmtPrint(out)},
 		"printf":  &tengo.UserFunction{Name: "printf", Value: fmtPrintf(out)},
 		"println": &tengo.UserFunction{Name: "println", Value: fmtPrintln(out)},
 		"sprintf": &tengo.UserFunction{Name: "sprintf", Value: fmtSprintf},
+
+		"eprint":   &tengo.UserFunction{Name: "eprint", Value: fmtPrint(errOut)},
+		"eprintf":  &tengo.UserFunction{Name: "eprintf", Value: fmtPrintf(errOut)},
+		"eprintln": &tengo.UserFunction{Name: "eprintln", Value: fmtPrintln(errOut)},
+
+		"scan":  &tengo.UserFunction{Name: "scan", Value: fmtScan(in)},
+		"input": &tengo.UserFunction{Name: "input", Value: fmtInput(out, in)},
 	}
 }
 
@@ -58,7 +80,7 @@ func fmtPrintf(out io.Writer) func(args ...tengo.Object) (ret tengo.Object, err
 			}
 		}
 		if numArgs == 1 {
-			fmt.Print(format)
+			fmt.Fprint(out, format.Value)
 			return nil, nil
 		}
 
@@ -108,6 +130,88 @@ func fmtSprintf(args ...tengo.Object) (ret tengo.Object, err error) {
 	return &tengo.String{Value: s}, nil
 }
 
+// fmtScan reads a line from stdin, undefined is returned once
+// there is nothing else to read. When stdin is a Prompter it is
+// used instead, without a prompt
+func fmtScan(in io.Reader) func(args ...tengo.Object) (ret tengo.Object, err error) {
+	return func(args ...tengo.Object) (ret tengo.Object, err error) {
+		if len(args) != 0 {
+			return nil, tengo.ErrWrongNumArguments
+		}
+		if line, ok, err := promptLine(in, ""); ok {
+			return line, err
+		}
+		return readLine(in)
+	}
+}
+
+// fmtInput shows the prompt and reads a line from stdin,
+// when stdin is a Prompter it is used instead
+func fmtInput(out io.Writer, in io.Reader) func(args ...tengo.Object) (ret tengo.Object, err error) {
+	return func(args ...tengo.Object) (ret tengo.Object, err error) {
+		if len(args) > 1 {
+			return nil, tengo.ErrWrongNumArguments
+		}
+		var prompt string
+		if len(args) == 1 {
+			prompt, _ = tengo.ToString(args[0])
+		}
+		if line, ok, err := promptLine(in, prompt); ok {
+			return line, err
+		}
+		_, _ = fmt.Fprint(out, prompt)
+		return readLine(in)
+	}
+}
+
+// promptLine asks in for a line when it is a Prompter, ok is false
+// if in cannot prompt and the line must be read from it instead
+func promptLine(in io.Reader, prompt string) (line tengo.Object, ok bool, err error) {
+	p, ok := in.(Prompter)
+	if !ok {
+		return nil, false, nil
+	}
+	text, err := p.Prompt(prompt)
+	switch err {
+	case nil:
+		return &tengo.String{Value: text}, true, nil
+	case io.EOF:
+		return tengo.UndefinedValue, true, nil
+	case errNoPrompter:
+		return nil, false, nil
+	default:
+		return nil, true, err
+	}
+}
+
+// readLine reads one byte at a time, so nothing after the line
+// is consumed from in
+func readLine(in io.Reader) (tengo.Object, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := in.Read(buf)
+		if n == 1 {
+			if buf[0] == '\n' {
+				break
+			}
+			line = append(line, buf[0])
+			if len(line) > tengo.MaxStringLen {
+				return nil, tengo.ErrStringLimit
+			}
+		}
+		if err == io.EOF {
+			if len(line) == 0 {
+				return tengo.UndefinedValue, nil
+			}
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return &tengo.String{Value: strings.TrimSuffix(string(line), "\r")}, nil
+}
+
 func getPrintArgs(args ...tengo.Object) ([]interface{}, error) {
 	var printArgs []interface{}
 	l := 0
@@ -0,0 +1,90 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPrompter answers prompts with lines, once they run out it
+// reports io.EOF. Reading from it directly fails the test
+type testPrompter struct {
+	t       *testing.T
+	lines   []string
+	prompts []string
+}
+
+func (p *testPrompter) Read([]byte) (int, error) {
+	p.t.Error("stdin was read instead of prompting")
+	return 0, io.EOF
+}
+
+func (p *testPrompter) Prompt(prompt string) (string, error) {
+	p.prompts = append(p.prompts, prompt)
+	if len(p.lines) == 0 {
+		return "", io.EOF
+	}
+	line := p.lines[0]
+	p.lines = p.lines[1:]
+	return line, nil
+}
+
+func TestFmtReadLines(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		code    string
+		stdin   string
+		prompt  []string
+		out     string
+		prompts []string
+	}{
+		{name: "scan stdin", code: `fmt.println(fmt.scan(), fmt.scan())`, stdin: "a\r\nb\n", out: "a b"},
+		{name: "scan eof", code: `fmt.println(is_undefined(fmt.scan()))`, out: "true"},
+		{name: "input stdin", code: `fmt.println(fmt.input("name? "))`, stdin: "ann\n", out: "name? ann"},
+		{name: "scan prompter", code: `fmt.println(fmt.scan(), fmt.scan())`, prompt: []string{"a", "b"}, out: "a b", prompts: []string{"", ""}},
+		{name: "scan prompter eof", code: `fmt.println(is_undefined(fmt.scan()))`, prompt: []string{}, out: "true", prompts: []string{""}},
+		{name: "input prompter", code: `fmt.println(fmt.input("name? "))`, prompt: []string{"ann"}, out: "ann", prompts: []string{"name? "}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestShell(t)
+			var in io.Reader = strings.NewReader(tt.stdin)
+			var p *testPrompter
+			if tt.prompt != nil {
+				p = &testPrompter{t: t, lines: tt.prompt}
+				in = p
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			var out bytes.Buffer
+			if err := s.Eval(ctx, &out, &out, `fmt := import("fmt")`+"\n"+tt.code, in); err != nil {
+				t.Fatal(err)
+			}
+			if got := lastLine(out.String()); got != tt.out {
+				t.Errorf("got %q, want %q", got, tt.out)
+			}
+			if p != nil && strings.Join(p.prompts, "|") != strings.Join(tt.prompts, "|") {
+				t.Errorf("prompts %q, want %q", p.prompts, tt.prompts)
+			}
+		})
+	}
+}
+
+func TestFmtPromptError(t *testing.T) {
+	s := newTestShell(t)
+	failed := errors.New("prompt closed")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := s.Eval(ctx, io.Discard, io.Discard, `fmt := import("fmt"); fmt.scan()`, failingPrompter{failed})
+	if err == nil || !strings.Contains(err.Error(), failed.Error()) {
+		t.Fatalf("got %v, want %v", err, failed)
+	}
+}
+
+type failingPrompter struct{ err error }
+
+func (failingPrompter) Read([]byte) (int, error)        { return 0, io.EOF }
+func (p failingPrompter) Prompt(string) (string, error) { return "", p.err }
@@ -0,0 +1,445 @@
+package shell
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/d5/tengo/v2"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// schemaObject is returned by schema.compile, calling it
+	// validates the argument and returns the list of errors
+	schemaObject struct {
+		tengo.ObjectImpl
+		source string
+		schema *jsonschema.Schema
+	}
+
+	schemaError struct {
+		path    string
+		pointer string
+		keyword string
+		message string
+	}
+
+	// rpcSchemas keeps the OpenRPC documents registered for each endpoint,
+	// calls to known methods have their params validated before being sent
+	rpcSchemas struct {
+		mu        sync.Mutex
+		endpoints map[string]map[string][]rpcParam
+	}
+
+	rpcParam struct {
+		name     string
+		required bool
+		schema   *jsonschema.Schema
+	}
+
+	openRPCDoc struct {
+		Methods []struct {
+			Name   string `json:"name"`
+			Params []struct {
+				Name     string          `json:"name"`
+				Required bool            `json:"required"`
+				Schema   json.RawMessage `json:"schema"`
+			} `json:"params"`
+		} `json:"methods"`
+	}
+)
+
+const (
+	schemaScheme = "sandbox"
+)
+
+var (
+	errRemoteSchema = errors.New("schema: only references to files inside the sandbox are allowed")
+)
+
+func (s *Shell) schemaModule() map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"compile": &tengo.UserFunction{
+			Name: "compile",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 1 {
+					return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+				}
+				return s.compileSchema(args[0])
+			},
+		},
+		"validate": &tengo.UserFunction{
+			Name: "validate",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 2 {
+					return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+				}
+				sch, ok := args[0].(*schemaObject)
+				if !ok {
+					var err error
+					if sch, err = s.compileSchema(args[0]); err != nil {
+						return tengo.UndefinedValue, err
+					}
+				}
+				return sch.Call(args[1])
+			},
+		},
+		"openrpc": &tengo.UserFunction{
+			Name:  "openrpc",
+			Value: s.registerOpenRPC,
+		},
+	}
+}
+
+// compileSchema accepts an inline schema (map) or the path
+// of a json or yaml document inside the sandbox
+func (s *Shell) compileSchema(doc tengo.Object) (*schemaObject, error) {
+	c := s.schemaCompiler()
+	var location string
+	switch doc := doc.(type) {
+	case *tengo.String:
+		if _, err := s.sandbox().resolve(doc.Value); err != nil {
+			return nil, err
+		}
+		location = schemaScheme + ":///" + strings.TrimPrefix(path.Clean("/"+doc.Value), "/")
+	case *tengo.Map, *tengo.ImmutableMap:
+		buf, err := json.Marshal(tengo.ToInterface(doc))
+		if err != nil {
+			return nil, err
+		}
+		location = schemaScheme + ":///(inline).json"
+		if err := c.AddResource(location, bytes.NewReader(buf)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "schema",
+			Expected: "string|map",
+			Found:    doc.TypeName(),
+		}
+	}
+	sch, err := c.Compile(location)
+	if err != nil {
+		return nil, err
+	}
+	return &schemaObject{source: location, schema: sch}, nil
+}
+
+// schemaCompiler returns a compiler which loads referenced
+// documents only from the sandbox filesystem
+func (s *Shell) schemaCompiler() *jsonschema.Compiler {
+	c := jsonschema.NewCompiler()
+	c.LoadURL = func(loc string) (io.ReadCloser, error) {
+		u, err := url.Parse(loc)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != schemaScheme {
+			return nil, errRemoteSchema
+		}
+		full, err := s.sandbox().resolve(strings.TrimPrefix(u.Path, "/"))
+		if err != nil {
+			return nil, err
+		}
+		buf, err := os.ReadFile(full)
+		if err != nil {
+			return nil, err
+		}
+		switch path.Ext(u.Path) {
+		case ".yaml", ".yml":
+			var v any
+			if err := yaml.Unmarshal(buf, &v); err != nil {
+				return nil, err
+			}
+			if buf, err = json.Marshal(normalize(v)); err != nil {
+				return nil, err
+			}
+		}
+		return io.NopCloser(bytes.NewReader(buf)), nil
+	}
+	return c
+}
+
+// registerOpenRPC implements openrpc(endpoint, [doc]), when doc is
+// omitted it is obtained by calling rpc.discover on the endpoint
+func (s *Shell) registerOpenRPC(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	endpoint, ok := tengo.ToString(args[0])
+	if !ok {
+		return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+			Name:     "endpoint",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+	}
+	var buf []byte
+	var err error
+	if len(args) == 1 {
+		buf, err = s.discoverOpenRPC(endpoint)
+	} else if file, ok := args[1].(*tengo.String); ok {
+		var full string
+		if full, err = s.sandbox().resolve(file.Value); err == nil {
+			buf, err = os.ReadFile(full)
+		}
+	} else {
+		buf, err = json.Marshal(tengo.ToInterface(args[1]))
+	}
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+
+	var doc openRPCDoc
+	if err := json.Unmarshal(buf, &doc); err != nil {
+		return tengo.UndefinedValue, fmt.Errorf("openrpc: %w", err)
+	}
+	c := s.schemaCompiler()
+	location := schemaScheme + ":///(openrpc).json"
+	if err := c.AddResource(location, bytes.NewReader(buf)); err != nil {
+		return tengo.UndefinedValue, err
+	}
+	methods := map[string][]rpcParam{}
+	names := &tengo.Array{}
+	for i, m := range doc.Methods {
+		var params []rpcParam
+		for j, p := range m.Params {
+			param := rpcParam{name: p.Name, required: p.Required}
+			if len(p.Schema) > 0 {
+				param.schema, err = c.Compile(fmt.Sprintf("%v#/methods/%v/params/%v/schema", location, i, j))
+				if err != nil {
+					return tengo.UndefinedValue, fmt.Errorf("openrpc: method %v param %v: %w", m.Name, p.Name, err)
+				}
+			}
+			params = append(params, param)
+		}
+		methods[m.Name] = params
+		names.Value = append(names.Value, &tengo.String{Value: m.Name})
+	}
+	s.rpcSchemas.set(endpoint, methods)
+	return names, nil
+}
+
+func (s *Shell) discoverOpenRPC(endpoint string) ([]byte, error) {
+	res, err := s.jsonrpcPost(s.ctx, endpoint, jsonRPCReq{
+		Version: "2.0",
+		Method:  "rpc.discover",
+		Params:  json.RawMessage("[]"),
+		ID:      "discover",
+	}, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("openrpc: unexpected status code from server: %v", res.StatusCode)
+	}
+	var reply jsonRPCReply
+	if err := json.NewDecoder(res.Body).Decode(&reply); err != nil {
+		return nil, err
+	}
+	if reply.Error.Code != 0 {
+		return nil, fmt.Errorf("[json-rpc-error: %v] %v", reply.Error.Code, reply.Error.Message)
+	} else if reply.Result == nil {
+		return nil, errors.New("openrpc: rpc.discover returned an empty result")
+	}
+	return *reply.Result, nil
+}
+
+// checkRPCParams validates the params of a request when
+// an OpenRPC document describing the method is known
+func (s *Shell) checkRPCParams(endpoint string, req jsonRPCReq) error {
+	params, found := s.rpcSchemas.lookup(endpoint, req.Method)
+	if !found {
+		return nil
+	}
+	value, err := decodeJSONNumbers(req.Params)
+	if err != nil {
+		return err
+	}
+	var errs []schemaError
+	for i, p := range params {
+		var v any
+		var present bool
+		switch value := value.(type) {
+		case []any:
+			if present = i < len(value); present {
+				v = value[i]
+			}
+		case map[string]any:
+			v, present = value[p.name]
+		}
+		if !present {
+			if p.required {
+				errs = append(errs, schemaError{path: "$" + pathKey(p.name), message: "missing required param"})
+			}
+			continue
+		}
+		if p.schema == nil {
+			continue
+		}
+		for _, e := range validationErrors(p.schema, v) {
+			e.path = "$" + pathKey(p.name) + strings.TrimPrefix(e.path, "$")
+			errs = append(errs, e)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = fmt.Sprintf("%v: %v", e.path, e.message)
+	}
+	return fmt.Errorf("jsonrpc: invalid params for %v: %v", req.Method, strings.Join(msgs, "; "))
+}
+
+func validationErrors(sch *jsonschema.Schema, v any) []schemaError {
+	err := sch.Validate(v)
+	var verr *jsonschema.ValidationError
+	if err == nil {
+		return nil
+	} else if !errors.As(err, &verr) {
+		return []schemaError{{path: "$", message: err.Error()}}
+	}
+	var out []schemaError
+	var leaves func(*jsonschema.ValidationError)
+	leaves = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			// the validator escapes locations as urls
+			pointer, err := url.PathUnescape(e.InstanceLocation)
+			if err != nil {
+				pointer = e.InstanceLocation
+			}
+			out = append(out, schemaError{
+				path:    pointerPath(pointer),
+				pointer: pointer,
+				keyword: e.KeywordLocation,
+				message: e.Message,
+			})
+		}
+		for _, c := range e.Causes {
+			leaves(c)
+		}
+	}
+	leaves(verr)
+	// properties are validated in map order, sort by location so
+	// the errors are reported in a stable order
+	sort.SliceStable(out, func(i, j int) bool { return out[i].pointer < out[j].pointer })
+	return out
+}
+
+// decodeJSONNumbers keeps numbers as json.Number,
+// which is what the validator expects
+func decodeJSONNumbers(buf []byte) (any, error) {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	err := dec.Decode(&v)
+	return v, err
+}
+
+// pointerPath converts a json pointer into the path syntax
+// used by the query and diff modules
+func pointerPath(ptr string) string {
+	var sb strings.Builder
+	sb.WriteString("$")
+	if ptr == "" {
+		return sb.String()
+	}
+	for _, tok := range strings.Split(strings.TrimPrefix(ptr, "/"), "/") {
+		tok = strings.NewReplacer("~1", "/", "~0", "~").Replace(tok)
+		if _, err := strconv.Atoi(tok); err == nil {
+			fmt.Fprintf(&sb, "[%v]", tok)
+			continue
+		}
+		sb.WriteString(pathKey(tok))
+	}
+	return sb.String()
+}
+
+func (e schemaError) object() tengo.Object {
+	return &tengo.ImmutableMap{Value: map[string]tengo.Object{
+		"path":    &tengo.String{Value: e.path},
+		"pointer": &tengo.String{Value: e.pointer},
+		"keyword": &tengo.String{Value: e.keyword},
+		"message": &tengo.String{Value: e.message},
+	}}
+}
+
+func (r *rpcSchemas) set(endpoint string, methods map[string][]rpcParam) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.endpoints == nil {
+		r.endpoints = map[string]map[string][]rpcParam{}
+	}
+	r.endpoints[endpoint] = methods
+}
+
+func (r *rpcSchemas) lookup(endpoint, method string) ([]rpcParam, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	params, found := r.endpoints[endpoint][method]
+	return params, found
+}
+
+func (r *rpcSchemas) clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.endpoints = nil
+}
+
+func (o *schemaObject) TypeName() string { return "schema" }
+func (o *schemaObject) String() string   { return fmt.Sprintf("<schema %v>", o.source) }
+func (o *schemaObject) CanCall() bool    { return true }
+
+// Call validates the argument and returns the errors found,
+// the array is empty for valid values
+func (o *schemaObject) Call(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	buf, err := json.Marshal(tengo.ToInterface(args[0]))
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	v, err := decodeJSONNumbers(buf)
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	out := &tengo.Array{Value: []tengo.Object{}}
+	for _, e := range validationErrors(o.schema, v) {
+		out.Value = append(out.Value, e.object())
+	}
+	return out, nil
+}
+
+func (o *schemaObject) IndexGet(index tengo.Object) (tengo.Object, error) {
+	key, _ := tengo.ToString(index)
+	switch key {
+	case "validate":
+		return &tengo.UserFunction{Name: "validate", Value: o.Call}, nil
+	case "valid":
+		return &tengo.UserFunction{
+			Name: "valid",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				errs, err := o.Call(args...)
+				if err != nil {
+					return tengo.UndefinedValue, err
+				}
+				return boolObject(len(errs.(*tengo.Array).Value) == 0), nil
+			},
+		}, nil
+	}
+	return tengo.UndefinedValue, nil
+}
@@ -0,0 +1,96 @@
+package shell
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const schemaPrelude = `schema := import("schema"); text := import("text")
+paths := func(errs) { out := []; for e in errs { out = append(out, e.path + " " + e.keyword) }; return text.join(out, ",") }
+person := {type: "object", required: ["name"], properties: {name: {type: "string"}, age: {type: "integer", minimum: 0}, tags: {type: "array", items: {type: "string"}}}}`
+
+func TestSchemaValidate(t *testing.T) {
+	runScripts(t, nil, schemaPrelude, []scriptTest{
+		{name: "valid", code: `len(schema.validate(person, {name: "a", age: 1}))`, want: "0"},
+		{name: "valid method", code: `schema.compile(person).valid({name: "a"})`, want: "true"},
+		{name: "invalid method", code: `schema.compile(person).valid({})`, want: "false"},
+		{name: "missing", code: `paths(schema.validate(person, {age: 1}))`, want: "$ /required"},
+		{name: "nested paths", code: `paths(schema.validate(person, {name: 1, age: -1, tags: ["x", 2]}))`,
+			want: "$.age /properties/age/minimum,$.name /properties/name/type,$.tags[1] /properties/tags/items/type"},
+		{name: "message", code: `schema.validate(person, {name: "a", age: -1})[0].message`, want: "must be >= 0 but found -1"},
+		{name: "compiled", code: `sch := schema.compile(person); len(sch({name: "a"})) + len(schema.validate(sch, {}))`, want: "1"},
+		{name: "invalid schema", code: `schema.compile({type: 1})`, fail: true},
+		{name: "wrong argument", code: `schema.compile(1)`, fail: true},
+		{name: "remote reference", code: `schema.compile({"$ref": "https://example.com/schema.json"})`, fail: true},
+	})
+}
+
+func TestSchemaFiles(t *testing.T) {
+	s := newTestShell(t)
+	files := map[string]string{
+		"schemas/person.yaml":  "type: object\nproperties:\n  address:\n    $ref: address.json\n",
+		"schemas/address.json": `{"type": "object", "required": ["city"]}`,
+	}
+	for name, content := range files {
+		full := filepath.Join(s.importsDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out, err := eval(t, s, schemaPrelude+"\n"+`paths(schema.validate("schemas/person.yaml", {address: {}}))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := lastLine(out), "$.address /properties/address/$ref/required"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, doc := range []string{"../person.json", "schemas/missing.json"} {
+		if _, err := eval(t, s, fmt.Sprintf(`import("schema").compile(%q)`, doc)); err == nil {
+			t.Errorf("compiling %v should fail", doc)
+		}
+	}
+}
+
+func TestSchemaOpenRPC(t *testing.T) {
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req jsonRPCReq
+		json.NewDecoder(r.Body).Decode(&req)
+		calls = append(calls, req.Method)
+		w.Header().Set("Content-Type", "application/json")
+		if req.Method == "rpc.discover" {
+			fmt.Fprintf(w, `{"jsonrpc": "2.0", "id": %q, "result": {"methods": [{"name": "add", "params": [
+				{"name": "a", "required": true, "schema": {"type": "integer"}},
+				{"name": "b", "schema": {"type": "integer"}}
+			]}]}}`, req.ID)
+			return
+		}
+		fmt.Fprintf(w, `{"jsonrpc": "2.0", "id": %q, "result": 3}`, req.ID)
+	}))
+	defer srv.Close()
+
+	setup := func(s *Shell) { s.EnableJSONRPCClient() }
+	prelude := fmt.Sprintf(`schema := import("schema"); jsonrpc := import("jsonrpc"); url := %q; schema.openrpc(url)`, srv.URL)
+	tests := []scriptTest{
+		{name: "valid", code: `jsonrpc.call(url, "add", [1, 2])`, want: "3"},
+		{name: "named", code: `jsonrpc.call(url, "add", {a: 1})`, want: "3"},
+		{name: "unknown method", code: `jsonrpc.call(url, "sub", ["x"])`, want: "3"},
+		{name: "invalid", code: `jsonrpc.call(url, "add", [1, "x"])`, fail: true},
+		{name: "missing", code: `jsonrpc.call(url, "add", {b: 1})`, fail: true},
+	}
+	runScripts(t, setup, prelude, tests)
+	// invalid calls are never sent
+	sent := strings.Join(calls, ",")
+	if want := strings.Repeat("rpc.discover,add,", 2) + "rpc.discover,sub,rpc.discover,rpc.discover"; sent != want {
+		t.Errorf("got calls %v, want %v", sent, want)
+	}
+}
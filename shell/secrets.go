@@ -0,0 +1,382 @@
+package shell
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/d5/tengo/v2"
+	"golang.org/x/crypto/scrypt"
+)
+
+type (
+	// secretVault keeps credentials encrypted with a key derived from
+	// a passphrase, values are only held in memory while unlocked
+	secretVault struct {
+		mu     sync.Mutex
+		key    []byte
+		salt   []byte
+		values map[string]string
+	}
+
+	vaultFile struct {
+		Version int    `json:"version"`
+		Salt    []byte `json:"salt"`
+		Nonce   []byte `json:"nonce"`
+		Data    []byte `json:"data"`
+	}
+
+	// secretObject wraps a value from the vault, scripts can pass it
+	// to functions which accept secrets but never see its contents
+	secretObject struct {
+		tengo.ObjectImpl
+		name  string
+		value string
+	}
+)
+
+const (
+	vaultFileName = "secrets.vault"
+	vaultVersion  = 1
+
+	// scrypt parameters recommended for interactive logins
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	vaultKeySize = 32
+)
+
+var (
+	errVaultLocked    = errors.New("secrets: vault is locked")
+	errBadPassphrase  = errors.New("secrets: wrong passphrase or corrupted vault")
+	errSecretNotFound = errors.New("secrets: secret not found")
+	errSecretExposed  = errors.New("secrets: secret values cannot be serialized")
+	errSecretVerb     = errors.New("secrets: flags, width, precision and argument indexes cannot be used with secrets")
+)
+
+// EnableSecrets exposes the secrets module to scripts, the vault
+// is kept in the directory configured by SetDataDir
+func (s *Shell) EnableSecrets() {
+	s.secretsMod = map[string]tengo.Object{
+		"get": &tengo.UserFunction{
+			Name:  "get",
+			Value: s.secretsGet,
+		},
+		"names": &tengo.UserFunction{
+			Name: "names",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				names, err := s.vault.names()
+				if err != nil {
+					return tengo.UndefinedValue, err
+				}
+				out := &tengo.Array{Value: make([]tengo.Object, 0, len(names))}
+				for _, n := range names {
+					out.Value = append(out.Value, &tengo.String{Value: n})
+				}
+				return out, nil
+			},
+		},
+		"unlocked": &tengo.UserFunction{
+			Name: "unlocked",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				return boolObject(s.SecretsUnlocked()), nil
+			},
+		},
+		"format": &tengo.UserFunction{
+			Name:  "format",
+			Value: secretsFormat,
+		},
+	}
+}
+
+// UnlockSecrets opens the vault, creating it if it does not exist yet
+func (s *Shell) UnlockSecrets(passphrase string) error {
+	if s.dataDir == "" {
+		return errNoDataDir
+	}
+	return s.vault.unlock(filepath.Join(s.dataDir, vaultFileName), passphrase)
+}
+
+// LockSecrets forgets the key and the values of the vault
+func (s *Shell) LockSecrets() {
+	s.vault.lock()
+}
+
+// SecretsUnlocked reports if UnlockSecrets succeeded
+func (s *Shell) SecretsUnlocked() bool {
+	s.vault.mu.Lock()
+	defer s.vault.mu.Unlock()
+	return s.vault.key != nil
+}
+
+// SecretNames returns the names of the secrets in the vault
+func (s *Shell) SecretNames() ([]string, error) {
+	return s.vault.names()
+}
+
+// SetSecret adds or replaces a secret and saves the vault
+func (s *Shell) SetSecret(name, value string) error {
+	if name == "" {
+		return errors.New("secrets: name cannot be empty")
+	}
+	return s.vault.update(filepath.Join(s.dataDir, vaultFileName), func(values map[string]string) {
+		values[name] = value
+	})
+}
+
+// DeleteSecret removes a secret and saves the vault
+func (s *Shell) DeleteSecret(name string) error {
+	return s.vault.update(filepath.Join(s.dataDir, vaultFileName), func(values map[string]string) {
+		delete(values, name)
+	})
+}
+
+func (s *Shell) secretsGet(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	name, ok := args[0].(*tengo.String)
+	if !ok {
+		return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+			Name:     "name",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+	}
+	s.vault.mu.Lock()
+	defer s.vault.mu.Unlock()
+	if s.vault.key == nil {
+		return tengo.UndefinedValue, errVaultLocked
+	}
+	value, found := s.vault.values[name.Value]
+	if !found {
+		return tengo.UndefinedValue, fmt.Errorf("%w: %v", errSecretNotFound, name.Value)
+	}
+	return &secretObject{name: name.Value, value: value}, nil
+}
+
+// secretsFormat implements format(layout, args...), which works like
+// fmt.sprintf but returns a secret when any argument is a secret.
+// ie.: secrets.format("Bearer %v", secrets.get("token"))
+func secretsFormat(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) == 0 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	layout, ok := args[0].(*tengo.String)
+	if !ok {
+		return tengo.UndefinedValue, tengo.ErrInvalidArgumentType{
+			Name:     "format",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+	}
+	var names []string
+	values := make([]any, 0, len(args)-1)
+	decorated, indexed := decoratedArgs(layout.Value)
+	for i, a := range args[1:] {
+		if sec, ok := a.(*secretObject); ok {
+			if indexed || decorated[i] {
+				return tengo.UndefinedValue, errSecretVerb
+			}
+			names = append(names, sec.name)
+			values = append(values, sec.value)
+			continue
+		}
+		values = append(values, tengo.ToInterface(a))
+	}
+	out := fmt.Sprintf(layout.Value, values...)
+	if len(names) == 0 {
+		return &tengo.String{Value: out}, nil
+	}
+	return &secretObject{name: fmt.Sprint(names), value: out}, nil
+}
+
+// decoratedArgs reports, for each argument used by layout, if its verb
+// has flags, width or precision. Those could be used to take parts of a
+// secret, eg.: %.1s gives its first character. When layout uses explicit
+// argument indexes, the arguments cannot be matched and indexed is set
+func decoratedArgs(layout string) (decorated map[int]bool, indexed bool) {
+	decorated = map[int]bool{}
+	arg := 0
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' {
+			continue
+		}
+		i++
+		start := i
+		for ; i < len(layout) && strings.IndexByte("+-# 0123456789.*[]", layout[i]) >= 0; i++ {
+			switch layout[i] {
+			case '*':
+				arg++
+			case '[':
+				indexed = true
+			}
+		}
+		if i >= len(layout) {
+			break
+		}
+		if layout[i] == '%' && i == start {
+			continue
+		}
+		decorated[arg] = i > start
+		arg++
+	}
+	return decorated, indexed
+}
+
+// secretValue returns the plain value of obj, which may be a secret,
+// only to be used right before sending it somewhere (eg.: headers)
+func secretValue(obj tengo.Object) string {
+	if sec, ok := obj.(*secretObject); ok {
+		return sec.value
+	}
+	str, _ := tengo.ToString(obj)
+	return str
+}
+
+func (v *secretVault) unlock(path, passphrase string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		key, err := vaultKey(passphrase, salt)
+		if err != nil {
+			return err
+		}
+		v.key, v.salt, v.values = key, salt, map[string]string{}
+		return v.save(path)
+	} else if err != nil {
+		return err
+	}
+	var f vaultFile
+	if err := json.Unmarshal(buf, &f); err != nil {
+		return fmt.Errorf("secrets: %v: %w", vaultFileName, err)
+	}
+	if f.Version != vaultVersion {
+		return fmt.Errorf("secrets: unsupported vault version %v", f.Version)
+	}
+	key, err := vaultKey(passphrase, f.Salt)
+	if err != nil {
+		return err
+	}
+	gcm, err := vaultCipher(key)
+	if err != nil {
+		return err
+	}
+	plain, err := gcm.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return errBadPassphrase
+	}
+	values := map[string]string{}
+	if err := json.Unmarshal(plain, &values); err != nil {
+		return errBadPassphrase
+	}
+	v.key, v.salt, v.values = key, f.Salt, values
+	return nil
+}
+
+func (v *secretVault) lock() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.key, v.salt, v.values = nil, nil, nil
+}
+
+func (v *secretVault) names() ([]string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.key == nil {
+		return nil, errVaultLocked
+	}
+	names := make([]string, 0, len(v.values))
+	for n := range v.values {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (v *secretVault) update(path string, fn func(values map[string]string)) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.key == nil {
+		return errVaultLocked
+	}
+	fn(v.values)
+	return v.save(path)
+}
+
+// save must be called with the lock held, a new nonce
+// is used every time the vault is written
+func (v *secretVault) save(path string) error {
+	plain, err := json.Marshal(v.values)
+	if err != nil {
+		return err
+	}
+	gcm, err := vaultCipher(v.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	buf, err := json.MarshalIndent(vaultFile{
+		Version: vaultVersion,
+		Salt:    v.salt,
+		Nonce:   nonce,
+		Data:    gcm.Seal(nil, nonce, plain, nil),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf)
+}
+
+func vaultKey(passphrase string, salt []byte) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("secrets: passphrase cannot be empty")
+	}
+	return scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, vaultKeySize)
+}
+
+func vaultCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (o *secretObject) TypeName() string { return "secret" }
+func (o *secretObject) String() string   { return fmt.Sprintf("<secret %v>", o.name) }
+
+func (o *secretObject) Copy() tengo.Object { return o }
+
+// Equals only matches the same secret, comparing values would let a
+// script guess the value one character at a time
+func (o *secretObject) Equals(other tengo.Object) bool {
+	sec, ok := other.(*secretObject)
+	return ok && sec == o
+}
+
+// MarshalJSON fails so secrets never end up in snapshots
+// or requests unless explicitly unwrapped
+func (o *secretObject) MarshalJSON() ([]byte, error) {
+	return nil, errSecretExposed
+}
+
+func (o *secretObject) MarshalText() ([]byte, error) {
+	return nil, errSecretExposed
+}
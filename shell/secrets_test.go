@@ -0,0 +1,96 @@
+package shell
+
+import (
+	"strings"
+	"testing"
+)
+
+func newSecretsShell(t *testing.T) *Shell {
+	t.Helper()
+	s := newTestShell(t)
+	s.EnableSecrets()
+	if err := s.UnlockSecrets("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetSecret("token", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSecretsFormat(t *testing.T) {
+	tests := []struct {
+		code string
+		fail bool
+	}{
+		{`secrets.format("Bearer %v", t)`, false},
+		{`secrets.format("%s", t)`, false},
+		{`secrets.format("%05d %s", 1, t)`, false},
+		{`secrets.format("100%% %v", t)`, false},
+		{`secrets.format("%.1s", t)`, true},
+		{`secrets.format("%10s", t)`, true},
+		{`secrets.format("%-10v", t)`, true},
+		{`secrets.format("%*s", 3, t)`, true},
+		{`secrets.format("%d %.0s", 1, t)`, true},
+		{`secrets.format("%[1]s", t)`, true},
+		{`secrets.format("x%.0s", t)`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			s := newSecretsShell(t)
+			out, err := eval(t, s, `
+secrets := import("secrets")
+t := secrets.get("token")
+v := `+tt.code)
+			if tt.fail && err == nil {
+				t.Fatal("expected an error")
+			} else if !tt.fail && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Contains(out, "hunter2") {
+				t.Fatalf("secret leaked: %v", out)
+			}
+		})
+	}
+}
+
+func TestSecretsEquality(t *testing.T) {
+	s := newSecretsShell(t)
+	out, err := eval(t, s, `
+fmt := import("fmt")
+secrets := import("secrets")
+t := secrets.get("token")
+fmt.println(t == t, t == secrets.get("token"), t == secrets.format("%v", t))
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "true false false") {
+		t.Fatalf("secrets compared by value: %v", out)
+	}
+}
+
+// TestSecretsGuess tries to recover the secret one character at a time
+func TestSecretsGuess(t *testing.T) {
+	s := newSecretsShell(t)
+	out, _ := eval(t, s, `
+fmt := import("fmt")
+secrets := import("secrets")
+t := secrets.get("token")
+chars := "abcdefghijklmnopqrstuvwxyz0123456789"
+found := ""
+for i := 1; i <= 7; i++ {
+	prefix := secrets.format("%."+i+"s", t)
+	for c in chars {
+		if secrets.format(found+string(c)+"%.0s", t) == prefix {
+			found += string(c)
+			break
+		}
+	}
+}
+fmt.println(found)
+`)
+	if strings.Contains(out, "hunter2") {
+		t.Fatalf("secret recovered: %v", out)
+	}
+}
@@ -0,0 +1,93 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+type (
+	// resources tracks everything a session started which must be
+	// stopped once the session is reset or the shell is closed
+	resources struct {
+		sync.Mutex
+		closers []*tracked
+	}
+
+	tracked struct {
+		io.Closer
+	}
+)
+
+// SetOutput configures where output produced outside of Eval is written,
+// ie.: by callbacks triggered from background events
+func (s *Shell) SetOutput(stdout, stderr io.Writer) {
+	s.session.Lock()
+	defer s.session.Unlock()
+	s.stdout.w = stdout
+	s.stderr.w = stderr
+}
+
+// Reset stops everything started by scripts and discards all
+// variables, the next Eval starts from a clean state
+func (s *Shell) Reset(ctx context.Context) error {
+	err := s.resources.closeAll()
+	s.session.Lock()
+	defer s.session.Unlock()
+	s.initRepl = sync.OnceFunc(s.prepareREPL)
+	s.rpcSchemas.clear()
+	s.rpcProfiles.clear()
+	s.redaction.reset()
+	s.events.clear()
+	return err
+}
+
+// Close stops everything started by scripts
+func (s *Shell) Close() error {
+	return s.resources.closeAll()
+}
+
+// background runs fn inside the session, once any running
+// evaluation finishes. Output goes to the writers configured
+// by SetOutput
+func (s *Shell) background(ctx context.Context, fn func() error) error {
+	s.session.Lock()
+	defer s.session.Unlock()
+	s.initRepl()
+	old := s.ctx
+	s.ctx = ctx
+	defer func() { s.ctx = old }()
+	return fn()
+}
+
+// track registers c to be closed when the session is reset,
+// the returned function removes c without closing it
+func (r *resources) track(c io.Closer) func() {
+	r.Lock()
+	defer r.Unlock()
+	t := &tracked{Closer: c}
+	r.closers = append(r.closers, t)
+	return func() {
+		r.Lock()
+		defer r.Unlock()
+		for i, v := range r.closers {
+			if v == t {
+				r.closers = append(r.closers[:i], r.closers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (r *resources) closeAll() error {
+	r.Lock()
+	closers := r.closers
+	r.closers = nil
+	r.Unlock()
+	var errs []error
+	for _, c := range closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
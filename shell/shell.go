@@ -3,8 +3,11 @@ package shell
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net/http"
 	"strings"
 	"sync"
 
@@ -15,29 +18,71 @@ import (
 
 type (
 	Shell struct {
-		ctx     context.Context
-		globals map[string]tengo.Object
+		ctx context.Context
 
 		fmtMod     map[string]tengo.Object
+		logMod     map[string]tengo.Object
 		jsonrpcMod map[string]tengo.Object
+		fsMod      map[string]tengo.Object
+		execMod    map[string]tengo.Object
+		httpMod    map[string]tengo.Object
+
+		httpserverMod map[string]tengo.Object
+		jobsMod       map[string]tengo.Object
+		kvMod         map[string]tengo.Object
+		secretsMod    map[string]tengo.Object
+
+		fs *sandboxFS
+
+		client     *http.Client
+		logHandler slog.Handler
+
+		policy *Policy
+		prompt PermissionPrompt
+		grants sessionGrants
+		audit  auditLog
+
+		rpcSchemas  rpcSchemas
+		rpcProfiles rpcProfiles
 
 		stdout, stderr proxyWriter
 		stdin          proxyReader
 		importsDir     string
+		dataDir        string
+		protected      []string
+		snapshots      SnapshotLoader
+
+		jobs   jobScheduler
+		events eventBus
+		vault  *secretVault
+		// kvActive is the kv transaction in progress,
+		// only used with the session lock held
+		kvActive *kvTx
+
+		redaction redactor
 
 		initRepl func()
 
+		// session serializes everything that touches the repl state,
+		// evaluations and callbacks triggered by background events
+		session   sync.Mutex
+		resources resources
+
 		repl struct {
 			constants []tengo.Object
 			globals   []tengo.Object
 			symbols   *tengo.SymbolTable
 			fileset   *parser.SourceFileSet
+			ret       int
 		}
 	}
 
 	snapshotFormat struct {
 		Data   map[string]json.RawMessage `json:"data"`
 		Failed map[string]struct{}        `json:"failed"`
+		// Redacted variables are kept in Data for reference,
+		// but are never restored
+		Redacted map[string]struct{} `json:"redacted,omitempty"`
 	}
 
 	proxyWriter struct {
@@ -51,26 +96,42 @@ type (
 	emptyBuffer struct{}
 )
 
+var (
+	errNoPrompter = errors.New("stdin cannot prompt")
+)
+
 func (p *proxyWriter) Write(buf []byte) (int, error) {
 	return p.w.Write(buf)
 }
 
+func (p *proxyWriter) WriteStyled(style Style, text string) (int, error) {
+	return writeStyled(p.w, style, text)
+}
+
 func (p *proxyReader) Read(buf []byte) (int, error) {
 	return p.r.Read(buf)
 }
 
+func (p *proxyReader) Prompt(prompt string) (string, error) {
+	if pr, ok := p.r.(Prompter); ok {
+		return pr.Prompt(prompt)
+	}
+	return "", errNoPrompter
+}
+
 func (emptyBuffer) Read(buf []byte) (int, error) { return 0, io.EOF }
 
 func New() *Shell {
 	s := &Shell{
-		ctx:     context.Background(),
-		globals: make(map[string]tengo.Object),
-		stdout:  proxyWriter{w: io.Discard},
-		stderr:  proxyWriter{w: io.Discard},
-		stdin:   proxyReader{r: emptyBuffer{}},
+		ctx:    context.Background(),
+		stdout: proxyWriter{w: io.Discard},
+		stderr: proxyWriter{w: io.Discard},
+		stdin:  proxyReader{r: emptyBuffer{}},
+		vault:  &secretVault{},
 	}
 	s.initRepl = sync.OnceFunc(s.prepareREPL)
-	s.fmtMod = safeFmt(&s.stdout)
+	s.fmtMod = safeFmt(&s.stdout, &s.stderr, &s.stdin)
+	s.logMod = s.logModule()
 	return s
 }
 
@@ -78,6 +139,11 @@ func (s *Shell) AllowImportFrom(dir string) {
 	s.importsDir = dir
 }
 
+// SetDataDir configures where modules like jobs keep their files
+func (s *Shell) SetDataDir(dir string) {
+	s.dataDir = dir
+}
+
 func (s *Shell) Parse(ctx context.Context, code string) (string, error) {
 	code = strings.TrimSpace(code)
 	_, _, err := s.parseAST(parser.NewFileSet(), code)
@@ -92,7 +158,19 @@ func (s *Shell) parseAST(fileSet *parser.SourceFileSet, code string) (*parser.So
 }
 
 func (s *Shell) Eval(ctx context.Context, sout, serr io.Writer, code string, sin io.Reader) error {
+	return s.eval(ctx, sout, serr, code, sin, true)
+}
+
+// eval runs code in the session, when echo is set the value
+// of expressions and assignments is printed like a repl would
+func (s *Shell) eval(ctx context.Context, sout, serr io.Writer, code string, sin io.Reader, echo bool) error {
+	s.session.Lock()
+	defer s.session.Unlock()
 	s.initRepl()
+	defer s.captureSensitive()
+	if sin == nil {
+		sin = emptyBuffer{}
+	}
 
 	updateShell := func(ctx context.Context) func() {
 		// update shell sets the context and redirects io
@@ -104,7 +182,7 @@ func (s *Shell) Eval(ctx context.Context, sout, serr io.Writer, code string, sin
 		s.ctx = ctx
 
 		oldsout := s.stdout.w
-		oldserr := s.stdout.w
+		oldserr := s.stderr.w
 		oldsin := s.stdin.r
 
 		s.stdout.w = sout
@@ -125,7 +203,9 @@ func (s *Shell) Eval(ctx context.Context, sout, serr io.Writer, code string, sin
 		return err
 	}
 
-	file = s.addPrints(file)
+	if echo {
+		file = s.addPrints(file)
+	}
 	c := tengo.NewCompiler(srcFile, s.repl.symbols, s.repl.constants, s.modules(), nil)
 	if s.importsDir != "" {
 		c.EnableFileImport(true)
@@ -136,11 +216,11 @@ func (s *Shell) Eval(ctx context.Context, sout, serr io.Writer, code string, sin
 	}
 
 	bytecode := c.Bytecode()
-	machine := tengo.NewVM(bytecode, s.repl.globals, -1)
-	if err := machine.Run(); err != nil {
+	// constants must be visible to callbacks invoked while the code runs
+	s.repl.constants = bytecode.Constants
+	if err := s.run(bytecode); err != nil {
 		return fmt.Errorf("tengo: eval error: %v", err)
 	}
-	s.repl.constants = bytecode.Constants
 	return nil
 }
 
@@ -204,6 +284,9 @@ func (s *Shell) prepareREPL() {
 		},
 	}
 
+	// slot used to collect return values from callbacks
+	s.repl.ret = symbolTable.Define("__repl_callback_ret__").Index
+
 	var constants []tengo.Object
 	s.repl.constants = constants
 	s.repl.globals = globals
@@ -214,29 +297,66 @@ func (s *Shell) prepareREPL() {
 func (s *Shell) modules() tengo.ModuleGetter {
 	mods := stdlib.GetModuleMap(safeModules...)
 	mods.AddBuiltinModule("fmt", s.fmtMod)
+	mods.AddBuiltinModule("log", s.logMod)
+	mods.AddBuiltinModule("yaml", s.yamlModule())
+	mods.AddBuiltinModule("toml", s.tomlModule())
+	mods.AddBuiltinModule("csv", s.csvModule())
+	mods.AddBuiltinModule("query", s.queryModule())
+	mods.AddBuiltinModule("diff", s.diffModule())
+	mods.AddBuiltinModule("schema", s.schemaModule())
+	mods.AddBuiltinModule("template", s.templateModule())
+	mods.AddBuiltinModule("timer", s.timerModule())
+	mods.AddBuiltinModule("events", s.eventsModule())
+	mods.AddBuiltinModule("redact", s.redactModule())
 	if s.jsonrpcMod != nil {
 		mods.AddBuiltinModule("jsonrpc", s.jsonrpcMod)
 	}
-	return mods
+	if s.fsMod != nil {
+		mods.AddBuiltinModule("fs", s.fsMod)
+	}
+	if s.execMod != nil {
+		mods.AddBuiltinModule("exec", s.execMod)
+	}
+	if s.httpMod != nil {
+		mods.AddBuiltinModule("http", s.httpMod)
+	}
+	if s.httpserverMod != nil {
+		mods.AddBuiltinModule("httpserver", s.httpserverMod)
+	}
+	if s.jobsMod != nil {
+		mods.AddBuiltinModule("jobs", s.jobsMod)
+	}
+	if s.kvMod != nil {
+		mods.AddBuiltinModule("kv", s.kvMod)
+	}
+	if s.secretsMod != nil {
+		mods.AddBuiltinModule("secrets", s.secretsMod)
+	}
+	return policyModules{s: s, mods: mods}
 }
 
 func (s *Shell) Snapshot(ctx context.Context, out io.Writer) error {
-	sp := snapshot{}
-	sp.from(s.globals)
-	output := snapshotFormat{
-		Data:   make(map[string]json.RawMessage),
-		Failed: make(map[string]struct{}),
-	}
-	for k, v := range sp.items {
-		buf, err := json.Marshal(v)
-		if err != nil {
-			output.Failed[k] = struct{}{}
-			continue
-		}
-		output.Data[k] = json.RawMessage(buf)
-	}
+	return s.ExportSnapshot(ctx, out, "json")
+}
 
-	return json.NewEncoder(out).Encode(output)
+// ExportSnapshot writes every variable that can be serialized using
+// one of json, yaml, toml or csv, only json can be restored.
+// Values are redacted according to the redaction rules, redacted
+// variables are listed in json snapshots and skipped on restore
+func (s *Shell) ExportSnapshot(ctx context.Context, out io.Writer, format string) error {
+	enc, found := snapshotEncoders[format]
+	if !found {
+		return fmt.Errorf("unknown snapshot format %q", format)
+	}
+	// callbacks might change the variables at any time, so they
+	// are copied with the lock held and encoded once it is released
+	s.session.Lock()
+	s.initRepl()
+	sp := snapshot{}
+	sp.from(s.replGlobals())
+	s.session.Unlock()
+	redacted := s.redactItems(sp.items)
+	return enc(out, sp.items, redacted)
 }
 
 func (s *Shell) RestoreSnapshot(ctx context.Context, in io.Reader) error {
@@ -245,16 +365,48 @@ func (s *Shell) RestoreSnapshot(ctx context.Context, in io.Reader) error {
 	if err != nil {
 		return err
 	}
+	s.session.Lock()
+	defer s.session.Unlock()
+	s.initRepl()
 	for k, v := range input.Data {
+		if _, found := input.Redacted[k]; found {
+			fmt.Fprintf(&s.stderr, "snapshot: %v was redacted, it was not restored\n", k)
+			continue
+		}
 		var val any
 		err = json.Unmarshal(v, &val)
 		if err != nil {
 			continue
 		}
-		s.globals[k], err = tengo.FromInterface(val)
+		obj, err := tengo.FromInterface(val)
 		if err != nil {
 			return err
 		}
+		symbol, _, found := s.repl.symbols.Resolve(k, false)
+		if !found || symbol.Scope != tengo.ScopeGlobal {
+			symbol = s.repl.symbols.Define(k)
+		}
+		s.repl.globals[symbol.Index] = obj
 	}
 	return nil
 }
+
+// replGlobals returns the variables defined by the user, the
+// objects are shared so the session lock must be held while
+// they are in use
+func (s *Shell) replGlobals() map[string]tengo.Object {
+	globals := make(map[string]tengo.Object)
+	for _, name := range s.repl.symbols.Names() {
+		if strings.HasPrefix(name, "__repl_") {
+			continue
+		}
+		symbol, _, found := s.repl.symbols.Resolve(name, false)
+		if !found || symbol.Scope != tengo.ScopeGlobal {
+			continue
+		}
+		if v := s.repl.globals[symbol.Index]; v != nil {
+			globals[name] = v
+		}
+	}
+	return globals
+}
@@ -0,0 +1,119 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/d5/tengo/v2"
+)
+
+func stringArgs(values ...string) []tengo.Object {
+	out := make([]tengo.Object, len(values))
+	for i, v := range values {
+		out[i] = &tengo.String{Value: v}
+	}
+	return out
+}
+
+// newTestShell returns a shell whose data directory is a temporary one
+func newTestShell(t *testing.T) *Shell {
+	t.Helper()
+	s := New()
+	dir := t.TempDir()
+	s.AllowImportFrom(dir)
+	s.SetDataDir(dir)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// eval runs code and returns what it printed
+func eval(t *testing.T, s *Shell, code string) (string, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	err := s.Eval(ctx, &stdout, &stderr, code, strings.NewReader(""))
+	return stdout.String() + stderr.String(), err
+}
+
+type (
+	// scriptTest runs code after a prelude, want is the last line it
+	// printed, usually the value of the last expression
+	scriptTest struct {
+		name string
+		code string
+		want string
+		fail bool
+	}
+)
+
+// runScripts runs each test in a new shell, setup enables the modules
+// the prelude imports
+func runScripts(t *testing.T, setup func(s *Shell), prelude string, tests []scriptTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestShell(t)
+			if setup != nil {
+				setup(s)
+			}
+			out, err := eval(t, s, prelude+"\n"+tt.code)
+			if tt.fail {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := lastLine(out); got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// lastLine ignores what was echoed before the last expression
+func lastLine(out string) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	return lines[len(lines)-1]
+}
+
+// waitFor evaluates code until its last line is want
+func waitFor(t *testing.T, s *Shell, code, want string) {
+	t.Helper()
+	var got string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		out, err := eval(t, s, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got = lastLine(out); got == want {
+			return
+		}
+	}
+	t.Fatalf("%v: expected %v, got %v", code, want, got)
+}
+
+// syncBuffer collects the output of callbacks
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
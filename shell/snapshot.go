@@ -1,9 +1,16 @@
 package shell
 
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
 	"reflect"
+	"sort"
 
+	"github.com/BurntSushi/toml"
 	"github.com/d5/tengo/v2"
+	"gopkg.in/yaml.v3"
 )
 
 type (
@@ -26,6 +33,13 @@ var (
 		reflect.TypeFor[*tengo.Array]():          snapshotArray,
 		reflect.TypeFor[*tengo.ImmutableArray](): snapshotArray,
 	}
+
+	snapshotEncoders = map[string]func(out io.Writer, items map[string]any, redacted map[string]struct{}) error{
+		"json": snapshotJSON,
+		"yaml": snapshotYAML,
+		"toml": snapshotTOML,
+		"csv":  snapshotCSV,
+	}
 )
 
 func snapshotArray(seen map[tengo.Object]any, v tengo.Object) (any, bool) {
@@ -51,7 +65,6 @@ func (s *snapshot) from(globals map[string]tengo.Object) {
 		if !ok {
 			continue
 		}
-		println("saving", k)
 		s.items[k] = out
 	}
 }
@@ -76,3 +89,81 @@ func (s *snapshot) takeOne(v tengo.Object) (any, bool) {
 	}
 	return val, ok
 }
+
+// snapshotJSON lists the redacted variables, so they are
+// not restored with the marker in place of their values
+func snapshotJSON(out io.Writer, items map[string]any, redacted map[string]struct{}) error {
+	output := snapshotFormat{
+		Data:     make(map[string]json.RawMessage),
+		Failed:   make(map[string]struct{}),
+		Redacted: redacted,
+	}
+	for k, v := range items {
+		buf, err := json.Marshal(v)
+		if err != nil {
+			output.Failed[k] = struct{}{}
+			continue
+		}
+		output.Data[k] = json.RawMessage(buf)
+	}
+	return json.NewEncoder(out).Encode(output)
+}
+
+func snapshotYAML(out io.Writer, items map[string]any, _ map[string]struct{}) error {
+	enc := yaml.NewEncoder(out)
+	defer enc.Close()
+	return enc.Encode(portable(items))
+}
+
+// snapshotTOML skips the values toml cannot represent, like arrays
+// holding undefined values, instead of failing the whole export
+func snapshotTOML(out io.Writer, items map[string]any, _ map[string]struct{}) error {
+	data := make(map[string]any, len(items))
+	for k, v := range portable(items) {
+		if err := toml.NewEncoder(io.Discard).Encode(map[string]any{k: v}); err != nil {
+			continue
+		}
+		data[k] = v
+	}
+	return toml.NewEncoder(out).Encode(data)
+}
+
+// snapshotCSV writes one row per variable with its value encoded as json
+func snapshotCSV(out io.Writer, items map[string]any, _ map[string]struct{}) error {
+	items = portable(items)
+	names := make([]string, 0, len(items))
+	for k := range items {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	w := csv.NewWriter(out)
+	w.Write([]string{"name", "value"})
+	for _, k := range names {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(items[k]); err != nil {
+			continue
+		}
+		w.Write([]string{k, string(bytes.TrimSpace(buf.Bytes()))})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// portable keeps only the values which survive a json round trip,
+// imported modules for example hold functions and are left out
+func portable(items map[string]any) map[string]any {
+	out := make(map[string]any, len(items))
+	for k, v := range items {
+		buf, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		if val, err := decodeJSONNumbers(buf); err == nil {
+			out[k] = normalize(val)
+		}
+	}
+	return out
+}
@@ -0,0 +1,80 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportSnapshot(t *testing.T) {
+	s := newTestShell(t)
+	if _, err := eval(t, s, `rows := [{id: 1, name: "a"}, {id: 2, name: "b"}]; n := 3; f := func() {}`); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		format string
+		want   []string
+		fail   bool
+	}{
+		{format: "json", want: []string{`"rows":[{"id":1,"name":"a"},{"id":2,"name":"b"}]`, `"n":3`}},
+		{format: "yaml", want: []string{"rows:", "name: a", `"n": 3`}},
+		{format: "toml", want: []string{"n = 3", "[[rows]]", `name = "a"`}},
+		{format: "csv", want: []string{"name,value", "n,3", `rows,"[{""id"":1,""name"":""a""},{""id"":2,""name"":""b""}]"`}},
+		{format: "xml", fail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out bytes.Buffer
+			err := s.ExportSnapshot(context.Background(), &out, tt.format)
+			if tt.fail {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(out.String(), w) {
+					t.Errorf("expected %q in:\n%v", w, out.String())
+				}
+			}
+			if strings.Contains(out.String(), "func") {
+				t.Errorf("functions cannot be exported:\n%v", out.String())
+			}
+		})
+	}
+}
+
+// TestSnapshotWhileCallbacksRun is meant for -race, callbacks change
+// the variables while snapshots are taken
+func TestSnapshotWhileCallbacksRun(t *testing.T) {
+	s := newTestShell(t)
+	s.SetOutput(io.Discard, io.Discard)
+	_, err := eval(t, s, `timer := import("timer")
+m := {}
+n := 0
+timer.every(1, func() { n++; m[string(n)] = [n] })`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		var out bytes.Buffer
+		if err := s.Snapshot(context.Background(), &out); err != nil {
+			t.Fatal(err)
+		}
+		var sp snapshotFormat
+		if err := json.Unmarshal(out.Bytes(), &sp); err != nil {
+			t.Fatal(err)
+		}
+		if _, found := sp.Data["m"]; !found {
+			t.Fatal("m was not saved")
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package shell
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/d5/tengo/v2"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// templateObject is returned by template.compile, calling
+	// it with the data renders the template
+	templateObject struct {
+		tengo.ObjectImpl
+		name string
+		exec func(w io.Writer, data any) error
+	}
+
+	templateOptions struct {
+		html       bool
+		missingKey string
+		delims     [2]string
+	}
+
+	// limitedBuffer stops templates from producing
+	// strings larger than tengo accepts
+	limitedBuffer struct {
+		bytes.Buffer
+	}
+)
+
+var (
+	templateFuncs = map[string]any{
+		"upper":       strings.ToUpper,
+		"lower":       strings.ToLower,
+		"trim":        strings.TrimSpace,
+		"trim_prefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trim_suffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":     func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"split":       func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":        templateJoin,
+		"contains":    func(sub, s string) bool { return strings.Contains(s, sub) },
+		"has_prefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"has_suffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"repeat":      templateRepeat,
+		"indent":      templateIndent,
+		"quote":       func(v any) string { return fmt.Sprintf("%q", fmt.Sprint(v)) },
+		"default":     templateDefault,
+		"json":        templateJSON,
+		"json_indent": templateJSONIndent,
+		"yaml":        templateYAML,
+		"keys":        templateKeys,
+		"add":         func(a, b any) (any, error) { return templateArith("add", a, b) },
+		"sub":         func(a, b any) (any, error) { return templateArith("sub", a, b) },
+		"mul":         func(a, b any) (any, error) { return templateArith("mul", a, b) },
+		"div":         func(a, b any) (any, error) { return templateArith("div", a, b) },
+		"now":         time.Now,
+		"date":        templateDate,
+	}
+
+	errTemplateLimit = errors.New("template: output exceeds the maximum string length")
+)
+
+// templateModule renders text/template (or html/template when the html
+// option is set) templates, options are: html (bool), strict (bool,
+// missing keys are errors), missingkey (zero|error|default)
+// and delims (array with the left and right delimiters)
+func (s *Shell) templateModule() map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"render": &tengo.UserFunction{
+			Name: "render",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 2 && len(args) != 3 {
+					return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+				}
+				tmpl, err := compileTemplate(args[0], args[2:]...)
+				if err != nil {
+					return tengo.UndefinedValue, err
+				}
+				return tmpl.Call(args[1])
+			},
+		},
+		"render_file": &tengo.UserFunction{
+			Name: "render_file",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 2 && len(args) != 3 {
+					return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+				}
+				tmpl, err := s.compileTemplateFile(args[0], args[2:]...)
+				if err != nil {
+					return tengo.UndefinedValue, err
+				}
+				return tmpl.Call(args[1])
+			},
+		},
+		"compile": &tengo.UserFunction{
+			Name: "compile",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 1 && len(args) != 2 {
+					return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+				}
+				return compileTemplate(args[0], args[1:]...)
+			},
+		},
+		"compile_file": &tengo.UserFunction{
+			Name: "compile_file",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 1 && len(args) != 2 {
+					return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+				}
+				return s.compileTemplateFile(args[0], args[1:]...)
+			},
+		},
+	}
+}
+
+func compileTemplate(src tengo.Object, opts ...tengo.Object) (*templateObject, error) {
+	text, ok := src.(*tengo.String)
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "template",
+			Expected: "string",
+			Found:    src.TypeName(),
+		}
+	}
+	o, err := templateOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return o.parse("(inline)", text.Value)
+}
+
+// compileTemplateFile reads the template from the sandbox, files
+// ending in .html or .htm are always rendered with html/template
+func (s *Shell) compileTemplateFile(file tengo.Object, opts ...tengo.Object) (*templateObject, error) {
+	full, err := s.sandbox().pathArg([]tengo.Object{file}, 0, "path")
+	if err != nil {
+		return nil, err
+	}
+	buf, err := os.ReadFile(full)
+	if err != nil {
+		return nil, err
+	}
+	o, err := templateOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(full)) {
+	case ".html", ".htm":
+		o.html = true
+	}
+	return o.parse(filepath.Base(full), string(buf))
+}
+
+func templateOpts(args ...tengo.Object) (templateOptions, error) {
+	opts := templateOptions{missingKey: "default"}
+	if len(args) == 0 {
+		return opts, nil
+	}
+	m, ok := tengo.ToInterface(args[0]).(map[string]any)
+	if !ok {
+		return opts, tengo.ErrInvalidArgumentType{
+			Name:     "opts",
+			Expected: "map",
+			Found:    args[0].TypeName(),
+		}
+	}
+	if v, ok := m["html"].(bool); ok {
+		opts.html = v
+	}
+	if v, ok := m["strict"].(bool); ok && v {
+		opts.missingKey = "error"
+	}
+	if v, ok := m["missingkey"].(string); ok {
+		switch v {
+		case "zero", "error", "default":
+			opts.missingKey = v
+		default:
+			return opts, fmt.Errorf("template: invalid missingkey option %q", v)
+		}
+	}
+	if v, ok := m["delims"].([]any); ok {
+		if len(v) != 2 {
+			return opts, errors.New("template: delims must have the left and right delimiters")
+		}
+		opts.delims = [2]string{fmt.Sprint(v[0]), fmt.Sprint(v[1])}
+	}
+	return opts, nil
+}
+
+func (o templateOptions) parse(name, text string) (*templateObject, error) {
+	missingKey := "missingkey=" + o.missingKey
+	if o.html {
+		t, err := htmltemplate.New(name).
+			Option(missingKey).
+			Delims(o.delims[0], o.delims[1]).
+			Funcs(templateFuncs).
+			Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		return &templateObject{name: name, exec: t.Execute}, nil
+	}
+	t, err := texttemplate.New(name).
+		Option(missingKey).
+		Delims(o.delims[0], o.delims[1]).
+		Funcs(templateFuncs).
+		Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &templateObject{name: name, exec: t.Execute}, nil
+}
+
+func (b *limitedBuffer) Write(buf []byte) (int, error) {
+	if b.Len()+len(buf) > tengo.MaxStringLen {
+		return 0, errTemplateLimit
+	}
+	return b.Buffer.Write(buf)
+}
+
+func templateJoin(sep string, items any) (string, error) {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("join: expected a list, got %T", items)
+	}
+	parts := make([]string, v.Len())
+	for i := range parts {
+		parts[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(parts, sep), nil
+}
+
+func templateRepeat(count int, s string) (string, error) {
+	if count < 0 || len(s)*count > tengo.MaxStringLen {
+		return "", errTemplateLimit
+	}
+	return strings.Repeat(s, count), nil
+}
+
+func templateIndent(spaces int, s string) string {
+	pad := strings.Repeat(" ", max(spaces, 0))
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// templateDefault returns def when v is missing or empty,
+// to be used as {{ .name | default "unknown" }}
+func templateDefault(def, v any) any {
+	if v == nil {
+		return def
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		if rv.Len() == 0 {
+			return def
+		}
+	}
+	return v
+}
+
+func templateJSON(v any) (string, error) {
+	buf, err := json.Marshal(v)
+	return string(buf), err
+}
+
+func templateJSONIndent(v any) (string, error) {
+	buf, err := json.MarshalIndent(v, "", "  ")
+	return string(buf), err
+}
+
+func templateYAML(v any) (string, error) {
+	buf, err := yaml.Marshal(v)
+	return string(buf), err
+}
+
+func templateKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// templateArith works on the int64 and float64 values produced by tengo
+// and on the int constants of the template
+func templateArith(op string, a, b any) (any, error) {
+	ai, aInt := templateInt(a)
+	bi, bInt := templateInt(b)
+	if aInt && bInt {
+		switch op {
+		case "add":
+			return ai + bi, nil
+		case "sub":
+			return ai - bi, nil
+		case "mul":
+			return ai * bi, nil
+		}
+		if bi == 0 {
+			return nil, errors.New("div: division by zero")
+		}
+		return ai / bi, nil
+	}
+	af, ok := templateFloat(a)
+	if !ok {
+		return nil, fmt.Errorf("%v: expected a number, got %T", op, a)
+	}
+	bf, ok := templateFloat(b)
+	if !ok {
+		return nil, fmt.Errorf("%v: expected a number, got %T", op, b)
+	}
+	switch op {
+	case "add":
+		return af + bf, nil
+	case "sub":
+		return af - bf, nil
+	case "mul":
+		return af * bf, nil
+	}
+	return af / bf, nil
+}
+
+func templateInt(v any) (int64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+func templateFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// templateDate formats t (a time, a unix timestamp in seconds or an
+// RFC 3339 string) using the Go layout
+func templateDate(layout string, t any) (string, error) {
+	switch t := t.(type) {
+	case time.Time:
+		return t.Format(layout), nil
+	case int64:
+		return time.Unix(t, 0).Format(layout), nil
+	case string:
+		parsed, err := time.Parse(time.RFC3339, t)
+		if err != nil {
+			return "", err
+		}
+		return parsed.Format(layout), nil
+	}
+	return "", fmt.Errorf("date: unsupported value %T", t)
+}
+
+func (o *templateObject) TypeName() string { return "template" }
+func (o *templateObject) String() string   { return fmt.Sprintf("<template %v>", o.name) }
+func (o *templateObject) CanCall() bool    { return true }
+
+// Call renders the template using the argument as data
+func (o *templateObject) Call(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	var out limitedBuffer
+	if err := o.exec(&out, tengo.ToInterface(args[0])); err != nil {
+		return tengo.UndefinedValue, err
+	}
+	return &tengo.String{Value: out.String()}, nil
+}
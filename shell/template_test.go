@@ -0,0 +1,78 @@
+package shell
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTemplateRender(t *testing.T) {
+	prelude := `template := import("template")`
+	runScripts(t, nil, prelude, []scriptTest{
+		{name: "data", code: `template.render("hi {{.name}}", {name: "bob"})`, want: "hi bob"},
+		{name: "range", code: `template.render("{{range .}}[{{.}}]{{end}}", [1, "a", true])`, want: "[1][a][true]"},
+		{name: "missing key", code: `template.render("{{.x}}", {})`, want: "<no value>"},
+		{name: "strict", code: `template.render("{{.x}}", {}, {strict: true})`, fail: true},
+		{name: "missingkey error", code: `template.render("{{.x}}", {}, {missingkey: "error"})`, fail: true},
+		{name: "invalid missingkey", code: `template.render("{{.x}}", {}, {missingkey: "nope"})`, fail: true},
+		{name: "delims", code: `template.render("[[.a]] {{.a}}", {a: 1}, {delims: ["[[", "]]"]})`, want: "1 {{.a}}"},
+		{name: "invalid delims", code: `template.render("", {}, {delims: ["[["]})`, fail: true},
+		{name: "html", code: `template.render("<p>{{.}}</p>", "<b>", {html: true})`, want: "<p>&lt;b&gt;</p>"},
+		{name: "text", code: `template.render("<p>{{.}}</p>", "<b>")`, want: "<p><b></p>"},
+		{name: "parse error", code: `template.render("{{.a", {})`, fail: true},
+		{name: "not a string", code: `template.render(1, {})`, fail: true},
+		{name: "compiled", code: `t := template.compile("{{.}}!"); t(1) + t(2)`, want: "1!2!"},
+		{name: "strings", code: `template.render(` + "`" + `{{upper .a}} {{.a | trim_prefix "a"}} {{join "," (split "-" .b)}} {{quote .a}}` + "`" + `, {a: "abc", b: "x-y"})`, want: `ABC bc x,y "abc"`},
+		{name: "default", code: `template.render(` + "`" + `{{.a | default "none"}} {{.b | default "none"}}` + "`" + `, {a: "", b: "x"})`, want: "none x"},
+		{name: "arith", code: `template.render("{{add 1 2}} {{sub 1 0.5}} {{mul 2 3}} {{div 7 2}} {{div 7.0 2}}", {})`, want: "3 0.5 6 3 3.5"},
+		{name: "arith on data", code: `template.render("{{add .n 1}}", {n: 41})`, want: "42"},
+		{name: "division by zero", code: `template.render("{{div 1 0}}", {})`, fail: true},
+		{name: "not a number", code: `template.render("{{add 1 .s}}", {s: "x"})`, fail: true},
+		{name: "json", code: `template.render("{{json .}}", {a: [1, 2]})`, want: `{"a":[1,2]}`},
+		{name: "keys", code: `template.render("{{keys .}}", {b: 1, a: 2})`, want: "[a b]"},
+		{name: "date", code: `template.render(` + "`" + `{{date "2006-01-02" .}}` + "`" + `, "2024-03-01T10:00:00Z")`, want: "2024-03-01"},
+		{name: "limit", code: `template.render(` + "`" + `{{repeat 1000000000000 "x"}}` + "`" + `, {})`, fail: true},
+	})
+}
+
+func TestTemplateFiles(t *testing.T) {
+	s := newTestShell(t)
+	files := map[string]string{
+		"report.txt":  "{{.title}}: {{.count}}",
+		"page.html":   "<h1>{{.title}}</h1>",
+		"strict.tmpl": "{{.missing}}",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(s.importsDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []scriptTest{
+		{name: "text", code: `template.render_file("report.txt", {title: "<a>", count: 2})`, want: "<a>: 2"},
+		{name: "html by extension", code: `template.render_file("page.html", {title: "<a>"})`, want: "<h1>&lt;a&gt;</h1>"},
+		{name: "compiled", code: `t := template.compile_file("report.txt"); t({title: "x", count: 1})`, want: "x: 1"},
+		{name: "options", code: `template.render_file("strict.tmpl", {}, {strict: true})`, fail: true},
+		{name: "missing file", code: `template.render_file("missing.txt", {})`, fail: true},
+		{name: "outside the sandbox", code: `template.render_file("../report.txt", {})`, fail: true},
+	}
+	if _, err := eval(t, s, `template := import("template")`); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := eval(t, s, tt.code)
+			if tt.fail {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := lastLine(out); got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/d5/tengo/v2"
+)
+
+type (
+	// timerHandle controls a callback scheduled by after or every,
+	// closing it (or resetting the session) cancels the callback
+	timerHandle struct {
+		ctx    context.Context
+		cancel context.CancelFunc
+		once   sync.Once
+	}
+)
+
+var (
+	errInvalidInterval = errors.New("timer: duration must be positive")
+)
+
+func (s *Shell) timerModule() map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"sleep": &tengo.UserFunction{
+			Name:  "sleep",
+			Value: s.timerSleep,
+		},
+		"after": &tengo.UserFunction{
+			Name: "after",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				return s.schedule(false, args...)
+			},
+		},
+		"every": &tengo.UserFunction{
+			Name: "every",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				return s.schedule(true, args...)
+			},
+		},
+	}
+}
+
+// timerSleep pauses the script, unlike times.sleep it
+// returns as soon as the evaluation is cancelled
+func (s *Shell) timerSleep(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	d, err := durationArg(args[0])
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return tengo.UndefinedValue, nil
+	case <-s.ctx.Done():
+		return tengo.UndefinedValue, s.ctx.Err()
+	}
+}
+
+// schedule implements after(d, fn) and every(d, fn), fn runs inside the
+// session once no evaluation is running. For every, returning false from
+// fn stops the timer, errors are reported and the timer keeps going
+func (s *Shell) schedule(repeat bool, args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 2 {
+		return tengo.UndefinedValue, tengo.ErrWrongNumArguments
+	}
+	d, err := durationArg(args[0])
+	if err != nil {
+		return tengo.UndefinedValue, err
+	} else if d <= 0 {
+		return tengo.UndefinedValue, errInvalidInterval
+	}
+	fn, err := callableArg(args[1], "fn")
+	if err != nil {
+		return tengo.UndefinedValue, err
+	}
+
+	h := &timerHandle{}
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+	untrack := s.resources.track(h)
+	go func() {
+		defer untrack()
+		defer h.Close()
+		var tick <-chan time.Time
+		if repeat {
+			t := time.NewTicker(d)
+			defer t.Stop()
+			tick = t.C
+		} else {
+			t := time.NewTimer(d)
+			defer t.Stop()
+			tick = t.C
+		}
+		for {
+			select {
+			case <-h.ctx.Done():
+				return
+			case <-tick:
+			}
+			var more bool
+			s.background(h.ctx, func() error {
+				if h.ctx.Err() != nil {
+					// stopped while waiting for the session
+					return nil
+				}
+				ret, err := s.call(fn)
+				if err != nil {
+					fmt.Fprintf(&s.stderr, "timer: callback failed: %v\n", err)
+				}
+				more = ret != tengo.FalseValue
+				return err
+			})
+			if !repeat || !more {
+				return
+			}
+		}
+	}()
+	return h.object(), nil
+}
+
+func (h *timerHandle) Close() error {
+	h.once.Do(h.cancel)
+	return nil
+}
+
+func (h *timerHandle) object() tengo.Object {
+	return &tengo.ImmutableMap{Value: map[string]tengo.Object{
+		"stop": &tengo.UserFunction{
+			Name: "stop",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				return tengo.UndefinedValue, h.Close()
+			},
+		},
+		"active": &tengo.UserFunction{
+			Name: "active",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				return boolObject(h.ctx.Err() == nil), nil
+			},
+		},
+	}}
+}
+
+func durationArg(arg tengo.Object) (time.Duration, error) {
+	d, ok := toDuration(arg)
+	if !ok {
+		return 0, tengo.ErrInvalidArgumentType{
+			Name:     "duration",
+			Expected: "int(ms)|string",
+			Found:    arg.TypeName(),
+		}
+	}
+	return d, nil
+}
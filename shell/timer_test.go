@@ -0,0 +1,115 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimerSleep(t *testing.T) {
+	s := newTestShell(t)
+	start := time.Now()
+	if _, err := eval(t, s, `timer := import("timer"); timer.sleep("20ms")`); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("sleep returned after %v", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	var out bytes.Buffer
+	err := s.Eval(ctx, &out, &out, `timer.sleep("10s")`, nil)
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("expected the deadline to stop sleep, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("sleep was not cancelled, returned after %v", elapsed)
+	}
+}
+
+func TestTimerArgs(t *testing.T) {
+	runScripts(t, nil, `timer := import("timer")`, []scriptTest{
+		{name: "zero", code: `timer.after(0, func() {})`, fail: true},
+		{name: "negative", code: `timer.every("-1s", func() {})`, fail: true},
+		{name: "not a duration", code: `timer.after(true, func() {})`, fail: true},
+		{name: "invalid duration", code: `timer.sleep("soon")`, fail: true},
+		{name: "not callable", code: `timer.after(10, 1)`, fail: true},
+		{name: "missing callback", code: `timer.after(10)`, fail: true},
+	})
+}
+
+func TestTimerCallbacks(t *testing.T) {
+	s := newTestShell(t)
+	var stderr syncBuffer
+	s.SetOutput(&syncBuffer{}, &stderr)
+	_, err := eval(t, s, `timer := import("timer")
+once := 0; timer.after(5, func() { once++ })
+n := 0; h := timer.every(5, func() {
+	n++
+	if n == 1 { return undefined.missing() }
+	return n < 3
+})`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, s, `once`, "1")
+	// the first callback fails, the timer keeps going until it returns false
+	waitFor(t, s, `n`, "3")
+	waitFor(t, s, `h.active()`, "false")
+	time.Sleep(20 * time.Millisecond)
+	waitFor(t, s, `[once, n]`, "[1, 3]")
+	if !strings.Contains(stderr.String(), "timer: callback failed") {
+		t.Errorf("the failure was not reported: %q", stderr.String())
+	}
+}
+
+func TestTimerStop(t *testing.T) {
+	s := newTestShell(t)
+	_, err := eval(t, s, `timer := import("timer")
+fired := false; h := timer.after("30ms", func() { fired = true }); h.stop(); h.stop()
+n := 0; e := timer.every(5, func() { n++ })`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, s, `h.active()`, "false")
+	waitFor(t, s, `n > 0`, "true")
+	waitFor(t, s, `e.stop(); e.active()`, "false")
+	if _, err := eval(t, s, `stopped := n`); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	waitFor(t, s, `[fired, n == stopped]`, "[false, true]")
+}
+
+func TestTimerReset(t *testing.T) {
+	s := newTestShell(t)
+	var stdout syncBuffer
+	s.SetOutput(&stdout, &syncBuffer{})
+	_, err := eval(t, s, `timer := import("timer"); fmt := import("fmt")
+timer.every(5, func() { fmt.print(".") })
+timer.after("10s", func() {})`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); stdout.String() == "" && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := s.Reset(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s.resources.Lock()
+	left := len(s.resources.closers)
+	s.resources.Unlock()
+	if left != 0 {
+		t.Errorf("%v timers are still tracked after reset", left)
+	}
+	ticks := stdout.String()
+	time.Sleep(50 * time.Millisecond)
+	if got := stdout.String(); got != ticks {
+		t.Errorf("callbacks ran after reset: %q, then %q", ticks, got)
+	}
+}
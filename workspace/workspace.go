@@ -0,0 +1,217 @@
+// Package workspace describes the directory where appshell keeps the
+// configuration, history, snapshots, scripts and data of a project
+package workspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andrebq/appshell/shell"
+)
+
+type (
+	// Workspace is a directory laid out as:
+	//
+	//	.appshell/
+	//		config.json       configuration
+	//		history.jsonl     commands shared by every window
+	//		permissions.json  decisions the user asked to remember
+	//		snapshots/        named snapshots of the variables
+	//		jobs.json, kv.json, secrets.vault
+	//
+	// scripts live anywhere else in the directory and are imported from
+	// it. Scripts cannot reach ControlDir, otherwise they could grant
+	// themselves permissions or schedule jobs by editing its files
+	Workspace struct {
+		Root   string
+		Config Config
+	}
+
+	// Config is read from ConfigFile
+	Config struct {
+		Redaction shell.RedactionRules `json:"redaction"`
+		Snapshots Retention            `json:"snapshots"`
+		// Grants are added to the policy of every session, jobs
+		// cannot ask for permissions so only these apply to them
+		Grants shell.Policy `json:"grants"`
+	}
+
+	// savedSnapshot is the part of the files in SnapshotsDir
+	// needed to find a snapshot, the GUI also keeps notes in them
+	savedSnapshot struct {
+		Name    string          `json:"name"`
+		Version int             `json:"version"`
+		Data    json.RawMessage `json:"snapshot"`
+	}
+
+	// Retention decides which snapshots are removed as new ones are
+	// saved, the most recent version of each name is always kept
+	Retention struct {
+		// MaxVersions kept for each name, zero keeps all of them
+		MaxVersions int `json:"maxVersions"`
+		// MaxAgeDays removes versions older than the given
+		// number of days, zero keeps them regardless of age
+		MaxAgeDays int `json:"maxAgeDays"`
+	}
+)
+
+const (
+	ControlDir = ".appshell"
+	ConfigFile = ControlDir + "/config.json"
+)
+
+// Open resolves dir, creating it if needed, and reads its configuration
+func Open(dir string) (*Workspace, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	ws := &Workspace{
+		Root: root,
+		Config: Config{
+			// without configuration only the values of secrets are redacted
+			Redaction: shell.RedactionRules{Secrets: []string{"*"}},
+			Snapshots: Retention{MaxVersions: 20},
+		},
+	}
+	if err := os.MkdirAll(ws.SnapshotsDir(), 0700); err != nil {
+		return nil, err
+	}
+	buf, err := os.ReadFile(ws.Path(ConfigFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return ws, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, &ws.Config); err != nil {
+		return nil, fmt.Errorf("%v: %w", ws.Path(ConfigFile), err)
+	}
+	return ws, nil
+}
+
+// Name is shown to the user to identify the workspace
+func (w *Workspace) Name() string {
+	return filepath.Base(w.Root)
+}
+
+// Path returns name inside the workspace
+func (w *Workspace) Path(name string) string {
+	return filepath.Join(w.Root, filepath.FromSlash(name))
+}
+
+// ControlPath returns name inside ControlDir
+func (w *Workspace) ControlPath(name string) string {
+	return filepath.Join(w.Root, ControlDir, name)
+}
+
+func (w *Workspace) HistoryFile() string {
+	return w.ControlPath("history.jsonl")
+}
+
+// LegacyHistoryFile is where older versions kept the history
+func (w *Workspace) LegacyHistoryFile() string {
+	return w.Path("history.json")
+}
+
+func (w *Workspace) PermissionsFile() string {
+	return w.ControlPath("permissions.json")
+}
+
+func (w *Workspace) SnapshotsDir() string {
+	return w.ControlPath("snapshots")
+}
+
+// LoadSnapshot returns the data of a named snapshot saved in SnapshotsDir,
+// version 0 returns the latest version. It implements shell.SnapshotLoader
+func (w *Workspace) LoadSnapshot(name string, version int) ([]byte, error) {
+	files, err := filepath.Glob(filepath.Join(w.SnapshotsDir(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var found *savedSnapshot
+	for _, f := range files {
+		buf, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var sp savedSnapshot
+		if json.Unmarshal(buf, &sp) != nil || sp.Name != name {
+			continue
+		}
+		if version == 0 && (found == nil || sp.Version > found.Version) || sp.Version == version {
+			found = &sp
+		}
+	}
+	if found == nil {
+		if version != 0 {
+			return nil, fmt.Errorf("snapshot %v v%d: %w", name, version, os.ErrNotExist)
+		}
+		return nil, fmt.Errorf("snapshot %v: %w", name, os.ErrNotExist)
+	}
+	return found.Data, nil
+}
+
+// LegacySnapshotFile is the single snapshot kept by older versions
+func (w *Workspace) LegacySnapshotFile() string {
+	return w.Path("snapshot.json")
+}
+
+// DataDir keeps the kv store, jobs and the secrets vault
+func (w *Workspace) DataDir() string {
+	return w.ControlPath("")
+}
+
+// Allow adds grant to the Grants, it is written as capability:resource,
+// for example rpc:api.example.com or exec:git
+func (c *Config) Allow(grant string) error {
+	capability, resource, ok := strings.Cut(grant, ":")
+	if !ok || resource == "" {
+		return fmt.Errorf("invalid grant %q, expected capability:resource", grant)
+	}
+	g := &c.Grants
+	switch shell.Capability(capability) {
+	case shell.CapModule:
+		g.Modules = append(g.Modules, resource)
+	case shell.CapRPC:
+		g.RPCHosts = append(g.RPCHosts, resource)
+	case shell.CapFS:
+		g.FSRoots = append(g.FSRoots, resource)
+	case shell.CapListen:
+		g.Listen = append(g.Listen, resource)
+	case shell.CapExec:
+		g.Executables = append(g.Executables, resource)
+	default:
+		return fmt.Errorf("invalid grant %q, unknown capability %q", grant, capability)
+	}
+	return nil
+}
+
+// Policy allows every module and the files of the workspace, along
+// with the Grants from the configuration. Relative FSRoots are
+// resolved from the workspace root
+func (w *Workspace) Policy() *shell.Policy {
+	g := w.Config.Grants
+	roots := []string{w.Root}
+	for _, r := range g.FSRoots {
+		if !filepath.IsAbs(r) {
+			r = w.Path(r)
+		}
+		roots = append(roots, r)
+	}
+	return &shell.Policy{
+		Modules:     append([]string{"*"}, g.Modules...),
+		RPCHosts:    append([]string(nil), g.RPCHosts...),
+		FSRoots:     roots,
+		Listen:      append([]string(nil), g.Listen...),
+		Executables: append([]string(nil), g.Executables...),
+	}
+}
+
+// ImportDir is where scripts are imported from
+func (w *Workspace) ImportDir() string {
+	return w.Root
+}
@@ -0,0 +1,199 @@
+package workspace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		rpc    []string
+		roots  []string
+		exec   []string
+	}{
+		{name: "defaults", config: ``, roots: []string{"."}},
+		{
+			name:   "grants",
+			config: `{"grants": {"rpcHosts": ["api.example.com"], "executables": ["git"], "fsRoots": ["data", "/srv/shared"]}}`,
+			rpc:    []string{"api.example.com"},
+			roots:  []string{".", "data", "/srv/shared"},
+			exec:   []string{"git"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.config != "" {
+				writeFile(t, filepath.Join(dir, ConfigFile), tt.config)
+			}
+			ws, err := Open(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := ws.Policy()
+			var roots []string
+			for _, r := range tt.roots {
+				if !filepath.IsAbs(r) {
+					r = ws.Path(r)
+				}
+				roots = append(roots, r)
+			}
+			if !reflect.DeepEqual(p.Modules, []string{"*"}) {
+				t.Errorf("modules: %v", p.Modules)
+			}
+			if !reflect.DeepEqual(p.FSRoots, roots) {
+				t.Errorf("expected roots %v, got %v", roots, p.FSRoots)
+			}
+			if !reflect.DeepEqual(p.RPCHosts, tt.rpc) && len(p.RPCHosts)+len(tt.rpc) > 0 {
+				t.Errorf("expected hosts %v, got %v", tt.rpc, p.RPCHosts)
+			}
+			if !reflect.DeepEqual(p.Executables, tt.exec) && len(p.Executables)+len(tt.exec) > 0 {
+				t.Errorf("expected executables %v, got %v", tt.exec, p.Executables)
+			}
+		})
+	}
+}
+
+func TestOpenLayout(t *testing.T) {
+	dir := t.TempDir()
+	ws, err := Open(filepath.Join(dir, "project", "..", "project"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(dir, "project")
+	if ws.Root != root || ws.Name() != "project" {
+		t.Fatalf("got root %v, name %v", ws.Root, ws.Name())
+	}
+	if info, err := os.Stat(ws.SnapshotsDir()); err != nil || !info.IsDir() {
+		t.Fatalf("the snapshots directory was not created: %v", err)
+	}
+	control := filepath.Join(root, ControlDir)
+	paths := []struct {
+		got, want string
+	}{
+		{ws.Path("scripts/a.tengo"), filepath.Join(root, "scripts", "a.tengo")},
+		{ws.ImportDir(), root},
+		{ws.DataDir(), control},
+		{ws.HistoryFile(), filepath.Join(control, "history.jsonl")},
+		{ws.PermissionsFile(), filepath.Join(control, "permissions.json")},
+		{ws.SnapshotsDir(), filepath.Join(control, "snapshots")},
+		// older versions kept these in the directory itself
+		{ws.LegacyHistoryFile(), filepath.Join(root, "history.json")},
+		{ws.LegacySnapshotFile(), filepath.Join(root, "snapshot.json")},
+	}
+	for _, p := range paths {
+		if p.got != p.want {
+			t.Errorf("expected %v, got %v", p.want, p.got)
+		}
+	}
+	if ws.Config.Snapshots != (Retention{MaxVersions: 20}) || !reflect.DeepEqual(ws.Config.Redaction.Secrets, []string{"*"}) {
+		t.Errorf("unexpected defaults %+v", ws.Config)
+	}
+
+	// opening it again reads the configuration, keeping
+	// the defaults of what it does not set
+	writeFile(t, filepath.Join(root, ConfigFile), `{"snapshots": {"maxVersions": 3, "maxAgeDays": 7}}`)
+	writeFile(t, ws.HistoryFile(), `{"code": "a"}`+"\n")
+	if ws, err = Open(root); err != nil {
+		t.Fatal(err)
+	}
+	if ws.Config.Snapshots != (Retention{MaxVersions: 3, MaxAgeDays: 7}) || !reflect.DeepEqual(ws.Config.Redaction.Secrets, []string{"*"}) {
+		t.Errorf("unexpected configuration %+v", ws.Config)
+	}
+	if buf, err := os.ReadFile(ws.HistoryFile()); err != nil || string(buf) != `{"code": "a"}`+"\n" {
+		t.Errorf("the history changed after opening the workspace: %q %v", buf, err)
+	}
+}
+
+func TestOpenInvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ConfigFile), `{"grants": []}`)
+	if _, err := Open(dir); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAllow(t *testing.T) {
+	tests := []struct {
+		grant string
+		fail  bool
+	}{
+		{grant: "module:kv"},
+		{grant: "rpc:api.example.com:8080"},
+		{grant: "fs:data"},
+		{grant: "listen:127.0.0.1:9000"},
+		{grant: "exec:git"},
+		{grant: "rpc", fail: true},
+		{grant: "rpc:", fail: true},
+		{grant: "network:x", fail: true},
+	}
+	var c Config
+	for _, tt := range tests {
+		if err := c.Allow(tt.grant); (err != nil) != tt.fail {
+			t.Errorf("%v: unexpected error %v", tt.grant, err)
+		}
+	}
+	want := Config{}
+	want.Grants.Modules = []string{"kv"}
+	want.Grants.RPCHosts = []string{"api.example.com:8080"}
+	want.Grants.FSRoots = []string{"data"}
+	want.Grants.Listen = []string{"127.0.0.1:9000"}
+	want.Grants.Executables = []string{"git"}
+	if !reflect.DeepEqual(c, want) {
+		t.Fatalf("expected %+v, got %+v", want.Grants, c.Grants)
+	}
+}
+
+func TestLoadSnapshot(t *testing.T) {
+	ws, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"a-v1.json":   `{"name": "a", "version": 1, "snapshot": {"data": {"v": 1}}}`,
+		"a-v3.json":   `{"name": "a", "version": 3, "snapshot": {"data": {"v": 3}}}`,
+		"b-v1.json":   `{"name": "b", "version": 1, "snapshot": {"data": {"v": 10}}}`,
+		"broken.json": `{`,
+	} {
+		writeFile(t, filepath.Join(ws.SnapshotsDir(), name), content)
+	}
+	tests := []struct {
+		name    string
+		version int
+		want    string
+		missing bool
+	}{
+		{name: "a", want: `{"data": {"v": 3}}`},
+		{name: "a", version: 1, want: `{"data": {"v": 1}}`},
+		{name: "b", want: `{"data": {"v": 10}}`},
+		{name: "a", version: 2, missing: true},
+		{name: "c", missing: true},
+	}
+	for _, tt := range tests {
+		buf, err := ws.LoadSnapshot(tt.name, tt.version)
+		if tt.missing {
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("%v v%d: expected os.ErrNotExist, got %v", tt.name, tt.version, err)
+			}
+			continue
+		}
+		if err != nil || string(buf) != tt.want {
+			t.Errorf("%v v%d: expected %v, got %s (%v)", tt.name, tt.version, tt.want, buf, err)
+		}
+	}
+}